@@ -0,0 +1,175 @@
+package fargo
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	fargocontext "fargo/context"
+	"fargo/middleware"
+	"fargo/validation"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// parseActionMapping 解析自定义方法中的参数名称, 如 "ListFood(id,page,q)", 并校验方法的参数和返回值.
+// 方法的参数按照名称依次从路由参数, url 参数以及表单中获取并转换成参数的类型, 支持的类型同 Bind;
+// 返回值可以为空, (error), (value) 或者 (value, error), 返回值会被自动输出.
+// Parameters:
+// - c:       controller 的反射值.
+// - mapping: 自定义方法, 如 ListFood 或者 ListFood(id,page,q).
+// Return:
+// - funcName: 方法名称, 如 ListFood.
+// - params:   参数名称, 方法没有参数时为空.
+// - err:      方法不存在, 参数个数不匹配或者参数和返回值的类型不支持.
+func parseActionMapping(c reflect.Value, mapping string) (funcName string, params []string, err error) {
+	funcName = strings.TrimSpace(mapping)
+	if i := strings.Index(funcName, "("); i != -1 {
+		if !strings.HasSuffix(funcName, ")") {
+			return "", nil, fmt.Errorf("method mapping format error: %s", mapping)
+		}
+		for _, name := range strings.Split(funcName[i+1:len(funcName)-1], ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				params = append(params, name)
+			}
+		}
+		funcName = strings.TrimSpace(funcName[:i])
+	}
+
+	method := c.MethodByName(funcName)
+	if !method.IsValid() {
+		return "", nil, fmt.Errorf("%s method doesn't exist in the controller %s", funcName, reflect.Indirect(c).Type().Name())
+	}
+	mt := method.Type()
+	if mt.NumIn() != len(params) {
+		return "", nil, fmt.Errorf("method %s takes %d params, got %d names in %s", funcName, mt.NumIn(), len(params), mapping)
+	}
+	for i := 0; i < mt.NumIn(); i++ {
+		if !bindableType(mt.In(i)) {
+			return "", nil, fmt.Errorf("method %s param %s: unsupported type %s", funcName, params[i], mt.In(i))
+		}
+	}
+	switch {
+	case mt.NumOut() > 2,
+		mt.NumOut() == 2 && mt.Out(1) != errorType:
+		return "", nil, fmt.Errorf("method %s must return nothing, (error), (value) or (value, error)", funcName)
+	}
+
+	return
+}
+
+// bindableType 类型是否可以由字符串转换, 同 setValues 支持的类型.
+func bindableType(t reflect.Type) bool {
+	if t == timeType {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return bindableType(t.Elem())
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return true
+		}
+		// 切片的每一个元素由一个值转换, 元素不能是 []byte 之外的切片.
+		e := t.Elem()
+		for e.Kind() == reflect.Ptr {
+			e = e.Elem()
+		}
+		return (e.Kind() != reflect.Slice || e.Elem().Kind() == reflect.Uint8) && bindableType(e)
+	case reflect.String, reflect.Bool, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// callAction 按照参数名称从请求中获取参数并调用方法, 参数转换失败时返回 400, 然后输出方法的返回值.
+// Parameters:
+// - ctx:    上下文.
+// - c:      controller.
+// - method: controller 的方法.
+// - params: 参数名称.
+func callAction(ctx *fargocontext.Context, c ControllerInterface, method reflect.Value, params []string) {
+	mt := method.Type()
+	in := make([]reflect.Value, mt.NumIn())
+	if len(params) > 0 {
+		ctx.Request.ParseForm()
+	}
+	var errs BindErrors
+	for i, name := range params {
+		in[i] = reflect.New(mt.In(i)).Elem()
+		values, ok := ctx.Request.Form[name]
+		if v, has := ctx.Input.Params[":"+name]; has {
+			values, ok = []string{v}, true
+		}
+		if !ok || len(values) == 0 {
+			continue
+		}
+		if err := setValues(in[i], values); err != nil {
+			errs = append(errs, &BindError{Field: name, Key: name, Value: strings.Join(values, ","), Err: err})
+		}
+	}
+	// 和方法返回的绑定错误一样输出 400.
+	if len(errs) > 0 {
+		serveActionError(ctx, c, errs)
+		return
+	}
+
+	out := method.Call(in)
+	if len(out) == 0 {
+		return
+	}
+
+	// 最后一个返回值为 error.
+	if last := out[len(out)-1]; last.Type() == errorType {
+		if !last.IsNil() {
+			serveActionError(ctx, c, last.Interface().(error))
+			return
+		}
+		out = out[:len(out)-1]
+	}
+	if len(out) == 0 {
+		return
+	}
+
+	result := out[0]
+	if (result.Kind() == reflect.Ptr || result.Kind() == reflect.Interface || result.Kind() == reflect.Map ||
+		result.Kind() == reflect.Slice) && result.IsNil() {
+		ctx.Output.SetStatus(http.StatusNoContent)
+		return
+	}
+	serveAction(ctx, c, http.StatusOK, result.Interface())
+}
+
+// serveActionError 输出方法返回的错误, HTTPException 使用其中的状态码, 参数绑定和校验错误为 400, 其他错误为 500.
+func serveActionError(ctx *fargocontext.Context, c ControllerInterface, err error) {
+	status, msg := http.StatusInternalServerError, err.Error()
+	switch e := err.(type) {
+	case *middleware.HTTPException:
+		status, msg = e.StatusCode, e.Description
+	case *BindError, BindErrors, *validation.Error, validation.Errors:
+		status = http.StatusBadRequest
+	default:
+		Error(err)
+		if !gDebug {
+			msg = http.StatusText(status)
+		}
+	}
+	serveAction(ctx, c, status, map[string]interface{}{"error": msg})
+}
+
+// serveAction 通过 Controller.Serve 输出方法的返回值.
+func serveAction(ctx *fargocontext.Context, c ControllerInterface, status int, data interface{}) {
+	s, ok := c.(interface {
+		Serve(status int, data interface{}) error
+	})
+	if !ok {
+		ctx.Output.Serve(status, "json", data, false)
+		return
+	}
+	if err := s.Serve(status, data); err != nil {
+		Error(err)
+	}
+}
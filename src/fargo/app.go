@@ -54,7 +54,7 @@ func (a *App) Run() {
 	header := strings.Replace(gHeader, "{{configue}}", *gConfigName, -1)
 	header = strings.Replace(header, "{{version}}", VERSION, -1)
 	header = strings.Replace(header, "{{host}}", fmt.Sprintf("%s:%d", fAddr, httpPort), -1)
-	fmt.Fprintf(os.Stdout, header)
+	fmt.Fprint(os.Stdout, header)
 
 	if err = writePid(); err != nil {
 		pwd, _ := os.Getwd()
@@ -63,6 +63,20 @@ func (a *App) Run() {
 		os.Exit(2)
 	}
 
+	// 严格路由模式下存在冲突或者非法的路由时启动失败.
+	if errs := a.Handlers.RouteErrors(); strictRouter && len(errs) > 0 {
+		for _, err = range errs {
+			Error(err)
+		}
+		time.Sleep(100 * time.Microsecond)
+		os.Exit(2)
+	}
+
+	// debug 模式下输出路由表.
+	if gDebug {
+		a.Handlers.PrintRoutes(os.Stdout)
+	}
+
 	// panic
 	Log.WatchPanic()
 
@@ -134,3 +148,64 @@ func (a *App) Router(path string, c ControllerInterface, mappingMethods ...strin
 	gApp.Handlers.Add(path, c, mappingMethods...)
 	return gApp
 }
+
+// AddVersion 添加指定 API 版本的路由, 如 AddVersion("v2", "/user/:id", &UserV2Controller{}).
+// Parameters:
+// - version:        API 版本, 如 v2.
+// - pattern:        注册的路由 URI.
+// - c:              controller 的接口对象.
+// - mappingMethods: 不定项的路由参数.
+// Return:
+//  - app:           fargo 对象.
+func (a *App) AddVersion(version, pattern string, c ControllerInterface, mappingMethods ...string) (app *App) {
+	a.Handlers.AddVersion(version, pattern, c, mappingMethods...)
+	return a
+}
+
+// Use 添加中间件, 中间件包裹整个请求的分发过程, 先添加的中间件在外层.
+// Parameters:
+// - middlewares: 中间件.
+// Return:
+//  - app:        fargo 对象.
+func (a *App) Use(middlewares ...Middleware) (app *App) {
+	a.Handlers.Use(middlewares...)
+	return a
+}
+
+// Routes 按照注册的顺序返回所有路由, 包括路由的 URI, 域名, http 方法, controller 以及过滤函数.
+// Return:
+//  - routes: 路由表.
+func (a *App) Routes() (routes []RouteInfo) {
+	return a.Handlers.Routes()
+}
+
+// Handler 将 http.Handler 挂载到 prefix 下, 如 Handler("/assets", http.FileServer(http.Dir("assets")), true).
+// Parameters:
+// - prefix:      挂载的 url 前缀.
+// - h:           http.Handler.
+// - stripPrefix: 是否在交给 h 之前去掉 url 中的 prefix.
+// Return:
+//  - app:        fargo 对象.
+func (a *App) Handler(prefix string, h http.Handler, stripPrefix bool) (app *App) {
+	a.Handlers.Handler(prefix, h, stripPrefix)
+	return a
+}
+
+// AutoRouter 添加智能路由, 将 /<controller>/<method>/... 映射到 controller 的导出方法上.
+// Parameters:
+// - c:   controller 的接口对象.
+// Return:
+//  - app: fargo 对象.
+func (a *App) AutoRouter(c ControllerInterface) (app *App) {
+	a.Handlers.AddAuto(c)
+	return a
+}
+
+// Namespace 新建一个路由分组, 分组内的路由共享 url 前缀和过滤函数.
+// Parameters:
+// - prefix: 分组的 url 前缀, 如 /api/v1.
+// Return:
+//  - ns:    路由分组.
+func (a *App) Namespace(prefix string) (ns *Namespace) {
+	return a.Handlers.Namespace(prefix)
+}
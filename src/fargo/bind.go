@@ -0,0 +1,404 @@
+package fargo
+
+import (
+	"bdlib/comm"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"fargo/validation"
+)
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	fileHeaderType = reflect.TypeOf((*multipart.FileHeader)(nil))
+)
+
+// BindError 绑定请求参数时某个字段的错误.
+type BindError struct {
+	// 结构体字段名, 嵌套的字段用 "." 连接, 如 Address.City.
+	Field string
+
+	// 请求参数的名称.
+	Key string
+
+	// 请求参数的值.
+	Value string
+
+	// 转换错误.
+	Err error
+}
+
+// Error 实现 error 接口.
+func (e *BindError) Error() string {
+	return fmt.Sprintf("bind %s from %s=%q: %v", e.Field, e.Key, e.Value, e.Err)
+}
+
+// BindErrors 绑定请求参数时所有字段的错误.
+type BindErrors []*BindError
+
+// Error 实现 error 接口.
+func (e BindErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Bind 将请求参数绑定到结构体上, 依次使用:
+// - request body, Content-Type 为 json 时通过 json tag 解析, 为 xml 时通过 xml tag 解析.
+// - url 参数, 表单以及 multipart 表单, 通过 form tag 获取参数名称, 没有 form tag 时依次使用 json tag 和字段名.
+// - 上传的文件, 绑定到 *multipart.FileHeader 和 []*multipart.FileHeader 类型的字段, form:"-" 表示忽略此字段.
+// - 路由参数, 通过 param tag 获取参数名称, 如 param:"id" 对应路由 /user/:id.
+// 后面的值会覆盖前面的值, 请求中没有的参数不会修改字段的值, 支持嵌套的结构体, 参数名为 address.city 的形式.
+// json body 中类型错误的字段会被跳过, 返回每一个顶层 key 的错误; xml 在第一个错误时停止解析, 只返回这一个错误,
+// 此时不再绑定其他参数.
+// 例如:
+//
+//	type UserForm struct {
+//		ID    int64     `param:"id"`
+//		Name  string    `form:"name" json:"name"`
+//		Tags  []string  `form:"tag"`
+//		Birth time.Time `form:"birth"`
+//	}
+//
+// Parameters:
+// - dst: 结构体指针.
+// Return:
+// - err: 类型转换失败时为 BindErrors, 包含每一个字段的错误.
+func (c *Controller) Bind(dst interface{}) (err error) {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("bind: dst must be a non-nil pointer to struct, got %T", dst)
+	}
+
+	var errs BindErrors
+	body := c.Ctx.Input.RequestBody
+	if body == nil && c.Ctx.Request.Body != nil && c.Ctx.Request.Method != "GET" && c.Ctx.Request.Method != "HEAD" {
+		body = c.Ctx.Input.Body()
+	}
+	if len(body) > 0 {
+		ct := strings.ToLower(c.Ctx.Input.Header("Content-Type"))
+		switch {
+		case strings.Contains(ct, "json"):
+			if err = json.Unmarshal(body, dst); err != nil {
+				te, ok := err.(*json.UnmarshalTypeError)
+				if !ok {
+					return fmt.Errorf("bind: %v", err)
+				}
+				// json.Unmarshal 会跳过类型错误的字段继续解析, 但是只返回第一个错误.
+				fieldErrs := jsonFieldErrors(body, rv.Elem().Type())
+				if len(fieldErrs) == 0 {
+					fieldErrs = BindErrors{{Field: te.Field, Key: te.Field, Value: te.Value, Err: err}}
+				}
+				errs = append(errs, fieldErrs...)
+			}
+		case strings.Contains(ct, "xml"):
+			if err = xml.Unmarshal(body, dst); err != nil {
+				return fmt.Errorf("bind: %v", err)
+			}
+		}
+	}
+
+	errs = append(errs, c.bindForm(rv.Elem(), true)...)
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// jsonFieldErrors 逐个解析 json 对象的每一个 key, 按照 body 中的顺序返回每一个 key 的类型错误.
+// Parameters:
+// - body: json body.
+// - t:    绑定的结构体类型.
+// Return:
+// - errs: 每一个字段的错误, body 不是 json 对象时为空.
+func jsonFieldErrors(body []byte, t reflect.Type) (errs BindErrors) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return
+		}
+		key, _ := tok.(string)
+		var raw json.RawMessage
+		if err = dec.Decode(&raw); err != nil {
+			return
+		}
+		// 只含有这一个 key 的对象, 字段名的匹配规则和 json.Unmarshal 一致.
+		one, _ := json.Marshal(map[string]json.RawMessage{key: raw})
+		if err = json.Unmarshal(one, reflect.New(t).Interface()); err != nil {
+			if te, ok := err.(*json.UnmarshalTypeError); ok {
+				errs = append(errs, &BindError{Field: te.Field, Key: te.Field, Value: te.Value, Err: err})
+			}
+		}
+	}
+
+	return
+}
+
+// ParseForm 将 url 参数, 表单以及 multipart 表单绑定到结构体上, 规则同 Bind, 不解析 request body 和路由参数.
+// Parameters:
+// - dst: 结构体指针.
+// Return:
+// - err: 类型转换失败时为 BindErrors.
+func (c *Controller) ParseForm(dst interface{}) (err error) {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("bind: dst must be a non-nil pointer to struct, got %T", dst)
+	}
+	if errs := c.bindForm(rv.Elem(), false); len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// Validate 根据 valid tag 校验结构体, 规则见 validation.Validate, 通常在 Bind 之后调用.
+// 校验失败时, runmode 为 api 时通过 Serve 输出 400 以及 {"errors": [{"field": "name", "rule": "required", "message": "..."}]},
+// 其他模式下将错误设置到 Data["Errors"] 中, 模板中可以通过 .Errors 获取, 如 {{index .Errors.Map "name"}}.
+// valid tag 非法时输出 500.
+// 例如:
+//
+//	var f UserForm
+//	if err := c.Bind(&f); err != nil || !c.Validate(&f) {
+//		return
+//	}
+//
+// Parameters:
+// - obj: 结构体或者结构体指针.
+// Return:
+// - ok:  是否通过校验.
+func (c *Controller) Validate(obj interface{}) (ok bool) {
+	errs, err := validation.Validate(obj)
+	if err != nil {
+		fmt.Println(comm.WrapError(err))
+		http.Error(c.Ctx.ResponseWriter, "500 Internal Server Error", http.StatusInternalServerError)
+		return false
+	}
+	if len(errs) == 0 {
+		return true
+	}
+
+	if runMode == "api" {
+		c.Serve(http.StatusBadRequest, map[string]interface{}{"errors": errs})
+	} else {
+		c.Data["Errors"] = errs
+	}
+
+	return false
+}
+
+// bindForm 将表单以及路由参数绑定到结构体上.
+// Parameters:
+// - v:          结构体.
+// - withParams: 是否绑定路由参数.
+// Return:
+// - errs:       每一个字段的错误.
+func (c *Controller) bindForm(v reflect.Value, withParams bool) (errs BindErrors) {
+	form := c.Input()
+	var files map[string][]*multipart.FileHeader
+	if c.Ctx.Request.MultipartForm != nil {
+		files = c.Ctx.Request.MultipartForm.File
+	}
+	var params map[string]string
+	if withParams {
+		params = c.Ctx.Input.Params
+	}
+
+	return bindStruct(v, "", "", form, files, params)
+}
+
+// bindStruct 递归绑定结构体的每一个字段.
+// Parameters:
+// - v:           结构体.
+// - fieldPrefix: 嵌套结构体的字段名前缀.
+// - keyPrefix:   嵌套结构体的参数名前缀.
+// - form:        url 参数以及表单.
+// - files:       上传的文件.
+// - params:      路由参数.
+// Return:
+// - errs:        每一个字段的错误.
+func bindStruct(v reflect.Value, fieldPrefix, keyPrefix string, form url.Values,
+	files map[string][]*multipart.FileHeader, params map[string]string) (errs BindErrors) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		fv := v.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+
+		// 匿名结构体的字段作为外层结构体的字段.
+		if f.Anonymous {
+			if fv.Kind() == reflect.Ptr && fv.Type().Elem().Kind() == reflect.Struct {
+				if fv.IsNil() {
+					fv.Set(reflect.New(fv.Type().Elem()))
+				}
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				errs = append(errs, bindStruct(fv, fieldPrefix, keyPrefix, form, files, params)...)
+				continue
+			}
+		}
+
+		key := tagName(f.Tag.Get("form"))
+		if key == "-" {
+			continue
+		}
+		if key == "" {
+			if key = tagName(f.Tag.Get("json")); key == "" || key == "-" {
+				key = f.Name
+			}
+		}
+		key = keyPrefix + key
+		field := fieldPrefix + f.Name
+
+		// 上传的文件.
+		if fv.Type() == fileHeaderType || fv.Kind() == reflect.Slice && fv.Type().Elem() == fileHeaderType {
+			if fhs := files[key]; len(fhs) > 0 {
+				if fv.Kind() == reflect.Slice {
+					fv.Set(reflect.ValueOf(fhs))
+				} else {
+					fv.Set(reflect.ValueOf(fhs[0]))
+				}
+			}
+			continue
+		}
+
+		// 嵌套的结构体.
+		if fv.Kind() == reflect.Struct && fv.Type() != timeType {
+			errs = append(errs, bindStruct(fv, field+".", key+".", form, files, params)...)
+			continue
+		}
+
+		values, ok := form[key]
+		if name := tagName(f.Tag.Get("param")); name != "" {
+			if pv, has := params[":"+strings.TrimPrefix(name, ":")]; has {
+				key, values, ok = name, []string{pv}, true
+			}
+		}
+		if !ok || len(values) == 0 {
+			continue
+		}
+		if err := setValues(fv, values); err != nil {
+			errs = append(errs, &BindError{Field: field, Key: key, Value: strings.Join(values, ","), Err: err})
+		}
+	}
+
+	return
+}
+
+// tagName 返回 struct tag 中的名称, 去掉 ",omitempty" 等选项.
+func tagName(tag string) string {
+	if i := strings.Index(tag, ","); i != -1 {
+		return tag[:i]
+	}
+	return tag
+}
+
+// setValues 将请求参数转换成字段的类型并赋值, 切片使用所有的值, 其他类型使用第一个值,
+// 指针先转换指向的类型, 如 *[]string 使用所有的值.
+// Parameters:
+// - fv:     字段.
+// - values: 请求参数的值.
+// Return:
+// - err:    类型转换失败.
+func setValues(fv reflect.Value, values []string) (err error) {
+	if fv.Kind() == reflect.Ptr {
+		pv := reflect.New(fv.Type().Elem())
+		if err = setValues(pv.Elem(), values); err != nil {
+			return
+		}
+		fv.Set(pv)
+		return
+	}
+	if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() != reflect.Uint8 {
+		s := reflect.MakeSlice(fv.Type(), len(values), len(values))
+		for i, value := range values {
+			if err = setValue(s.Index(i), value); err != nil {
+				return
+			}
+		}
+		fv.Set(s)
+		return
+	}
+
+	return setValue(fv, values[0])
+}
+
+// setValue 将字符串转换成字段的类型并赋值.
+// Parameters:
+// - fv:    字段.
+// - value: 字符串.
+// Return:
+// - err:   类型转换失败或者不支持的类型.
+func setValue(fv reflect.Value, value string) (err error) {
+	if fv.Kind() == reflect.Ptr {
+		pv := reflect.New(fv.Type().Elem())
+		if err = setValue(pv.Elem(), value); err != nil {
+			return
+		}
+		fv.Set(pv)
+		return
+	}
+	if fv.Type() == timeType {
+		var t time.Time
+		if t, err = time.Parse(time.RFC3339, value); err != nil {
+			if t, err = time.ParseInLocation("2006-01-02", value, time.Local); err != nil {
+				return
+			}
+		}
+		fv.Set(reflect.ValueOf(t))
+		return
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(value)
+	case reflect.Bool:
+		var b bool
+		if b, err = strconv.ParseBool(value); err == nil {
+			fv.SetBool(b)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		if n, err = strconv.ParseInt(value, 10, fv.Type().Bits()); err == nil {
+			fv.SetInt(n)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var n uint64
+		if n, err = strconv.ParseUint(value, 10, fv.Type().Bits()); err == nil {
+			fv.SetUint(n)
+		}
+	case reflect.Float32, reflect.Float64:
+		var n float64
+		if n, err = strconv.ParseFloat(value, fv.Type().Bits()); err == nil {
+			fv.SetFloat(n)
+		}
+	case reflect.Slice:
+		// 只有 []byte 可以由一个值转换, 其他切片由 setValues 转换.
+		if fv.Type().Elem().Kind() != reflect.Uint8 {
+			return fmt.Errorf("unsupported type %s", fv.Type())
+		}
+		fv.SetBytes([]byte(value))
+	default:
+		err = fmt.Errorf("unsupported type %s", fv.Type())
+	}
+
+	return
+}
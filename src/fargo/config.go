@@ -91,6 +91,9 @@ var (
 	// gHTTPServerTimeOut server 超时时间
 	gHTTPServerTimeOut int64
 
+	// requestTimeout 请求的 context.Context 的超时时间, 单位毫秒, 为 0 时不超时.
+	requestTimeout int64
+
 	// maxMemory post 最大内存
 	maxMemory int64
 )
@@ -127,6 +130,11 @@ var (
 
 	// runMode 网站开发模式, 如 debug 等.
 	runMode string
+
+	// apiVersion 默认的 API 版本, 如 v1.
+	apiVersion string
+	// deprecatedVersions 废弃的 API 版本, 多个版本用逗号分隔.
+	deprecatedVersions string
 )
 
 // true or false, that is the question
@@ -184,11 +192,17 @@ var (
 	// XSRFExpire xsrf 的生存时间
 	XSRFExpire int64
 
+	// FlashName flash 消息在 session 或者 cookie 中的名称.
+	FlashName = "FARGO_FLASH"
+
 	// EnableLDAPHTTPS LDAP 是否开启 HTTPS
 	EnableLDAPHTTPS = false
 
 	// RouterCaseSensitive router case sensitive default is true.
 	RouterCaseSensitive = true
+
+	// strictRouter 存在重复, 被遮蔽或者非法的路由时是否启动失败.
+	strictRouter = false
 )
 
 // 提示信息模板
@@ -1,16 +1,95 @@
 package context
 
 import (
+	stdcontext "context"
 	"net/http"
+
+	"fargo/middleware"
 )
 
 // Context 上下文结构
 // FargoInput 和 FargoOutput 提供了一系列封装便于对 request 和 response 进行操作
+//
+// Context 以及对应的 Input, Output 在请求结束之后会被重置并复用于其他请求, 处理函数返回之后仍然持有 Context 的引用,
+// 如在 goroutine 中使用, 必须在返回之前调用 Retain, 否则读到的是被清空或者属于其他请求的数据.
 type Context struct {
 	Input          *FargoInput
 	Output         *FargoOutput
 	Request        *http.Request
 	ResponseWriter http.ResponseWriter
+
+	// 请求的 context.Context, 为 nil 时使用 Request.Context().
+	ctx stdcontext.Context
+
+	// 请求结束之后是否仍然被使用, 为 true 时不再被复用.
+	retained bool
+}
+
+// Reset 重置 Context 以便复用, Input 和 Output 一起被重置.
+// Parameters:
+// - rw: 新请求的 http.ResponseWriter.
+// - r:  新请求的 http.Request.
+func (c *Context) Reset(rw http.ResponseWriter, r *http.Request) {
+	c.ResponseWriter = rw
+	c.Request = r
+	c.ctx = nil
+	c.retained = false
+	c.Input.Reset(r)
+	c.Output.Reset()
+}
+
+// Retain 标记 Context 在请求结束之后仍然被使用, 如传给请求结束之后还在运行的 goroutine,
+// 被标记的 Context 以及对应的 Input, Output, controller 不会被框架复用.
+// hijack 连接以及 websocket 请求会自动标记.
+func (c *Context) Retain() {
+	c.retained = true
+}
+
+// Retained 是否已经被 Retain 标记.
+// Return:
+//  - retained: 是否已经被标记.
+func (c *Context) Retained() (retained bool) {
+	return c.retained
+}
+
+// Context 返回请求的 context.Context, 由 Request.Context() 派生, 客户端断开连接,
+// 请求超时([web] requesttimeout 或者 Route.Timeout) 以及请求结束时被取消,
+// 应当传给数据库, redis, http 等下游调用, 如 db.QueryContext(c.Ctx.Context(), ...).
+// Return:
+//  - ctx: 请求的 context.Context.
+func (c *Context) Context() (ctx stdcontext.Context) {
+	if c.ctx != nil {
+		return c.ctx
+	}
+	if c.Request != nil {
+		return c.Request.Context()
+	}
+	return stdcontext.Background()
+}
+
+// SetContext 替换请求的 context.Context, 新的 ctx 应当由 Context() 派生, 如增加超时或者追踪信息.
+// Parameters:
+// - ctx: 新的 context.Context.
+func (c *Context) SetContext(ctx stdcontext.Context) {
+	c.ctx = ctx
+}
+
+// SetValue 在请求的 context.Context 中附加一个值, 如过滤函数中设置当前用户或者请求 id, 之后通过 Value 获取,
+// 值同时会随 Context() 传递给下游调用. key 应当使用自定义的类型, 避免和其他包冲突.
+// Parameters:
+// - key:   key 值.
+// - value: 要附加的值.
+func (c *Context) SetValue(key, value interface{}) {
+	c.ctx = stdcontext.WithValue(c.Context(), key, value)
+}
+
+// Value 获取请求的 context.Context 中 key 对应的值, 没有时返回 nil.
+// Parameters:
+// - key:    key 值.
+// Return:
+//  - value: key 对应的值.
+func (c *Context) Value(key interface{}) (value interface{}) {
+	return c.Context().Value(key)
 }
 
 // Redirect 带有 http header status code 的强制跳转.
@@ -22,6 +101,20 @@ func (c *Context) Redirect(status int, localurl string) {
 	c.Output.SetStatus(status)
 }
 
+// Abort 中止请求, 以 status 状态码输出 body, body 为空时输出 middleware.ErrorMaps 中对应的错误页面,
+// 已经有输出时不再输出. 通过 panic 实现, 由框架 recover, controller 的 Finish 以及 AFTER_EXEC 的过滤函数仍然会执行.
+// Parameters:
+// - status: 状态码, 如 403.
+// - body:   输出的内容.
+func (c *Context) Abort(status int, body string) {
+	panic(&middleware.HTTPException{StatusCode: status, Description: body})
+}
+
+// StopRun 中止请求, 不再输出任何内容, 已经输出的内容保持不变, 同 Abort 通过 panic 实现.
+func (c *Context) StopRun() {
+	panic(&middleware.HTTPException{})
+}
+
 // WriteString 输出一个字符串到 response body.
 // Parameters:
 // - content: 要输出到 body 的内容.
@@ -49,7 +142,7 @@ func (c *Context) GetCookie(key string) (cookie string) {
 // Parameters:
 // - name:   要设置的 cookie 的 key.
 // - value:  要设置的 cookie 的 值.
-// - others: 其他 cookie 的选项, 如 path、HttpOnly 等.
+// - others: 其他 cookie 的选项, 如 path、HttpOnly 等, 也可以为 CookieOptions.
 func (c *Context) SetCookie(name string, value string, others ...interface{}) {
 	c.Output.Cookie(name, value, others...)
 }
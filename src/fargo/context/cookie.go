@@ -0,0 +1,228 @@
+package context
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CookieOptions cookie 的选项, 作为 Cookie, SetCookie, SetSignedCookie 以及 SetEncryptedCookie 的 others 参数, 例如:
+//
+//	ctx.SetCookie("token", token, context.CookieOptions{MaxAge: 3600, Path: "/", HttpOnly: true, SameSite: http.SameSiteLaxMode})
+type CookieOptions struct {
+	// 有效时间, 单位秒, 大于 0 时输出 Max-Age, 小于 0 时删除 cookie, 为 0 时为会话 cookie.
+	MaxAge int
+
+	// cookie 的路径, 为空时不输出.
+	Path string
+
+	// cookie 的域名, 为空时不输出.
+	Domain string
+
+	// 是否只通过 https 发送.
+	Secure bool
+
+	// 是否禁止 javascript 读取.
+	HttpOnly bool
+
+	// SameSite 属性, 为 http.SameSiteNoneMode 时浏览器要求同时设置 Secure, 会自动加上.
+	SameSite http.SameSite
+}
+
+// writeTo 将选项按照 Set-Cookie 的格式写入 b.
+func (opts *CookieOptions) writeTo(b *bytes.Buffer) {
+	if opts.MaxAge > 0 {
+		fmt.Fprintf(b, "; Max-Age=%d", opts.MaxAge)
+	} else if opts.MaxAge < 0 {
+		fmt.Fprintf(b, "; Max-Age=0")
+	}
+	if opts.Path != "" {
+		fmt.Fprintf(b, "; Path=%s", sanitizeValue(opts.Path))
+	}
+	if opts.Domain != "" {
+		fmt.Fprintf(b, "; Domain=%s", sanitizeValue(opts.Domain))
+	}
+	if opts.Secure || opts.SameSite == http.SameSiteNoneMode {
+		fmt.Fprintf(b, "; Secure")
+	}
+	if opts.HttpOnly {
+		fmt.Fprintf(b, "; HttpOnly")
+	}
+	switch opts.SameSite {
+	case http.SameSiteLaxMode:
+		fmt.Fprintf(b, "; SameSite=Lax")
+	case http.SameSiteStrictMode:
+		fmt.Fprintf(b, "; SameSite=Strict")
+	case http.SameSiteNoneMode:
+		fmt.Fprintf(b, "; SameSite=None")
+	}
+}
+
+// cookieKey 签名以及加密 cookie 使用的 key.
+type cookieKey struct {
+	// HMAC-SHA256 签名 key.
+	sign []byte
+
+	// AES-256-GCM 加密.
+	aead cipher.AEAD
+}
+
+// cookieKeys 签名以及加密 cookie 的 key, 第一个为最新的 key.
+var cookieKeys []cookieKey
+
+// errNoCookieKeys 没有设置 cookie key.
+var errNoCookieKeys = errors.New("cookie keys are not set, see [web] cookiekeys")
+
+// SetCookieKeys 设置签名以及加密 cookie 的 key, 对应配置 [web] cookiekeys.
+// 第一个 key 为最新的 key, 用于签名和加密, 其余的旧 key 只用于验证和解密, 以便轮换 key 时已有的 cookie 仍然有效.
+// Parameters:
+// - keys: key 列表, 最新的在前面, 空白的 key 被忽略.
+func SetCookieKeys(keys []string) {
+	var ks []cookieKey
+	for _, key := range keys {
+		if key = strings.TrimSpace(key); key == "" {
+			continue
+		}
+		// 签名和加密使用由 key 派生出的不同的 key.
+		block, _ := aes.NewCipher(deriveKey(key, "fargo cookie encrypt"))
+		aead, _ := cipher.NewGCM(block)
+		ks = append(ks, cookieKey{sign: deriveKey(key, "fargo cookie sign"), aead: aead})
+	}
+	cookieKeys = ks
+}
+
+// HasCookieKeys 是否设置了签名以及加密 cookie 的 key.
+func HasCookieKeys() bool {
+	return len(cookieKeys) > 0
+}
+
+// deriveKey 由 key 派生出 purpose 用途的 32 字节 key.
+func deriveKey(key, purpose string) []byte {
+	h := hmac.New(sha256.New, []byte(key))
+	h.Write([]byte(purpose))
+	return h.Sum(nil)
+}
+
+// signCookie 使用 key 对 cookie 名称, 值以及签名时间签名, 名称参与签名, 签名的值不能用于其他 cookie.
+func signCookie(key []byte, name, value, timestamp string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(name))
+	h.Write([]byte{'|'})
+	h.Write([]byte(value))
+	h.Write([]byte{'|'})
+	h.Write([]byte(timestamp))
+	return h.Sum(nil)
+}
+
+// SetSignedCookie 设置 HMAC-SHA256 签名的 cookie, 值没有加密, 客户端可以读取但是不能修改,
+// 签名时间一起签名, 读取时通过 GetSignedCookie 的 maxAge 拒绝过期的 cookie.
+// Parameters:
+// - name:   cookie 的名称.
+// - value:  cookie 的值.
+// - others: 同 SetCookie, 可以为 CookieOptions.
+// Return:
+// - err:    没有设置 cookie key.
+func (c *Context) SetSignedCookie(name, value string, others ...interface{}) (err error) {
+	if len(cookieKeys) == 0 {
+		return errNoCookieKeys
+	}
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(value))
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	sig := base64.RawURLEncoding.EncodeToString(signCookie(cookieKeys[0].sign, name, encoded, timestamp))
+	c.Output.Cookie(name, encoded+"."+timestamp+"."+sig, others...)
+
+	return
+}
+
+// GetSignedCookie 获取 SetSignedCookie 设置的 cookie, 依次使用所有的 key 验证签名.
+// Parameters:
+// - name:   cookie 的名称.
+// - maxAge: 有效时间, 单位秒, 签名时间在 maxAge 秒之前的 cookie 无效, 一般和设置时的 CookieOptions.MaxAge 相同,
+//           为 0 时不检查签名时间.
+// Return:
+// - value:  cookie 的值.
+// - ok:     cookie 存在, 签名正确并且没有过期.
+func (c *Context) GetSignedCookie(name string, maxAge int) (value string, ok bool) {
+	parts := strings.Split(c.Input.Cookie(name), ".")
+	if len(parts) != 3 {
+		return
+	}
+	encoded, timestamp := parts[0], parts[1]
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return
+	}
+	for _, key := range cookieKeys {
+		if !hmac.Equal(sig, signCookie(key.sign, name, encoded, timestamp)) {
+			continue
+		}
+		issued, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil || maxAge > 0 && time.Now().Unix()-issued > int64(maxAge) {
+			return "", false
+		}
+		b, err := base64.RawURLEncoding.DecodeString(encoded)
+		if err != nil {
+			return "", false
+		}
+		return string(b), true
+	}
+
+	return
+}
+
+// SetEncryptedCookie 设置 AES-GCM 加密的 cookie, 客户端不能读取也不能修改.
+// Parameters:
+// - name:   cookie 的名称.
+// - value:  cookie 的值.
+// - others: 同 SetCookie, 可以为 CookieOptions.
+// Return:
+// - err:    没有设置 cookie key 或者生成随机数失败.
+func (c *Context) SetEncryptedCookie(name, value string, others ...interface{}) (err error) {
+	if len(cookieKeys) == 0 {
+		return errNoCookieKeys
+	}
+	aead := cookieKeys[0].aead
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(value)+aead.Overhead())
+	if _, err = rand.Read(nonce); err != nil {
+		return
+	}
+	// 名称作为附加数据, 加密的值不能用于其他 cookie.
+	sealed := aead.Seal(nonce, nonce, []byte(value), []byte(name))
+	c.Output.Cookie(name, base64.RawURLEncoding.EncodeToString(sealed), others...)
+
+	return
+}
+
+// GetEncryptedCookie 获取 SetEncryptedCookie 设置的 cookie, 依次使用所有的 key 解密.
+// Parameters:
+// - name:  cookie 的名称.
+// Return:
+// - value: 解密之后的值.
+// - ok:    cookie 存在并且解密成功.
+func (c *Context) GetEncryptedCookie(name string) (value string, ok bool) {
+	sealed, err := base64.RawURLEncoding.DecodeString(c.Input.Cookie(name))
+	if err != nil {
+		return
+	}
+	for _, key := range cookieKeys {
+		n := key.aead.NonceSize()
+		if len(sealed) < n+key.aead.Overhead() {
+			return
+		}
+		if b, err := key.aead.Open(nil, sealed[:n], sealed[n:], []byte(name)); err == nil {
+			return string(b), true
+		}
+	}
+
+	return
+}
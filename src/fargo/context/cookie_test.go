@@ -0,0 +1,133 @@
+package context
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestContext 新建一个用于测试的 Context, 请求带上 cookies.
+func newTestContext(cookies ...*http.Cookie) (c *Context, rw *httptest.ResponseRecorder) {
+	r := httptest.NewRequest("GET", "/", nil)
+	for _, cookie := range cookies {
+		r.AddCookie(cookie)
+	}
+	rw = httptest.NewRecorder()
+	c = &Context{Input: NewInput(nil), Output: NewOutput()}
+	c.Output.Context = c
+	c.Reset(rw, r)
+	return
+}
+
+func TestCookieOptions(t *testing.T) {
+	cases := []struct {
+		opts   CookieOptions
+		expect string
+	}{
+		{CookieOptions{}, "name=v"},
+		{CookieOptions{MaxAge: 60, Path: "/", HttpOnly: true, SameSite: http.SameSiteNoneMode},
+			"name=v; Max-Age=60; Path=/; Secure; HttpOnly; SameSite=None"},
+		{CookieOptions{MaxAge: -1, Domain: "example.com", SameSite: http.SameSiteStrictMode},
+			"name=v; Max-Age=0; Domain=example.com; SameSite=Strict"},
+		{CookieOptions{Secure: true, SameSite: http.SameSiteLaxMode}, "name=v; Secure; SameSite=Lax"},
+	}
+	for _, c := range cases {
+		ctx, rw := newTestContext()
+		ctx.SetCookie("name", "v", c.opts)
+		if s := rw.Header().Get("Set-Cookie"); s != c.expect {
+			t.Errorf("expect %q, got %q", c.expect, s)
+		}
+	}
+}
+
+func TestSignedCookie(t *testing.T) {
+	defer SetCookieKeys(nil)
+
+	ctx, _ := newTestContext()
+	if err := ctx.SetSignedCookie("signed", "alice"); err != errNoCookieKeys {
+		t.Errorf("expect errNoCookieKeys, got %v", err)
+	}
+
+	SetCookieKeys([]string{"old"})
+	ctx, rw := newTestContext()
+	if err := ctx.SetSignedCookie("signed", "alice", CookieOptions{Path: "/"}); err != nil {
+		t.Fatal(err)
+	}
+	value := rw.Result().Cookies()[0].Value
+
+	// sign 以 old 签名 issued 时设置的 cookie.
+	sign := func(issued time.Time) string {
+		encoded := base64.RawURLEncoding.EncodeToString([]byte("alice"))
+		timestamp := strconv.FormatInt(issued.Unix(), 10)
+		sig := signCookie(deriveKey("old", "fargo cookie sign"), "signed", encoded, timestamp)
+		return encoded + "." + timestamp + "." + base64.RawURLEncoding.EncodeToString(sig)
+	}
+	dot := strings.Index(value, ".")
+
+	cases := []struct {
+		keys   []string
+		name   string
+		value  string
+		maxAge int
+		expect string
+		ok     bool
+	}{
+		{[]string{"new", "old"}, "signed", value, 60, "alice", true},
+		{[]string{"new"}, "signed", value, 60, "", false},
+		// 修改值, 签名时间或者用于其他名称的 cookie 时签名不正确.
+		{[]string{"old"}, "signed", "Ym9i" + value[dot:], 60, "", false},
+		{[]string{"old"}, "signed", value[:dot] + ".1" + value[strings.LastIndex(value, "."):], 0, "", false},
+		{[]string{"old"}, "other", value, 60, "", false},
+		{[]string{"old"}, "signed", "alice", 60, "", false},
+		// 超过 maxAge 的 cookie 无效, maxAge 为 0 时不检查.
+		{[]string{"old"}, "signed", sign(time.Now().Add(-2 * time.Minute)), 60, "", false},
+		{[]string{"old"}, "signed", sign(time.Now().Add(-2 * time.Minute)), 180, "alice", true},
+		{[]string{"old"}, "signed", sign(time.Now().Add(-48 * time.Hour)), 0, "alice", true},
+	}
+	for i, c := range cases {
+		SetCookieKeys(c.keys)
+		ctx, _ := newTestContext(&http.Cookie{Name: c.name, Value: c.value})
+		if v, ok := ctx.GetSignedCookie(c.name, c.maxAge); v != c.expect || ok != c.ok {
+			t.Errorf("case %d: expect %q %v, got %q %v", i, c.expect, c.ok, v, ok)
+		}
+	}
+}
+
+func TestEncryptedCookie(t *testing.T) {
+	defer SetCookieKeys(nil)
+
+	SetCookieKeys([]string{"old"})
+	ctx, rw := newTestContext()
+	if err := ctx.SetEncryptedCookie("secret", "bob", &CookieOptions{SameSite: http.SameSiteStrictMode}); err != nil {
+		t.Fatal(err)
+	}
+	if s := rw.Header().Get("Set-Cookie"); !strings.HasSuffix(s, "; SameSite=Strict") || strings.Contains(s, "bob") {
+		t.Fatalf("unexpected cookie %q", s)
+	}
+	value := rw.Result().Cookies()[0].Value
+
+	cases := []struct {
+		keys   []string
+		name   string
+		value  string
+		expect string
+		ok     bool
+	}{
+		{[]string{"new", "old"}, "secret", value, "bob", true},
+		{[]string{"new"}, "secret", value, "", false},
+		{[]string{"old"}, "other", value, "", false},
+		{[]string{"old"}, "secret", value[:len(value)-2], "", false},
+		{[]string{"old"}, "secret", "Ym9i", "", false},
+	}
+	for i, c := range cases {
+		SetCookieKeys(c.keys)
+		ctx, _ := newTestContext(&http.Cookie{Name: c.name, Value: c.value})
+		if v, ok := ctx.GetEncryptedCookie(c.name); v != c.expect || ok != c.ok {
+			t.Errorf("case %d: expect %q %v, got %q %v", i, c.expect, c.ok, v, ok)
+		}
+	}
+}
@@ -20,6 +20,12 @@ type FargoInput struct {
 	// 参数
 	Params map[string]string
 
+	// 带类型的路由参数转换之后的值, 如 :id:int64 为 int64.
+	ParamValues map[string]interface{}
+
+	// 请求的 API 版本, 如 v2, 没有版本时为空.
+	APIVersion string
+
 	// 在控制层中调用的时候存储的数据
 	Data map[interface{}]interface{}
 
@@ -41,6 +47,29 @@ func NewInput(r *http.Request) (m *FargoInput) {
 	}
 }
 
+// Reset 重置输入对象以便复用, Params 和 Data 被清空但是尽量不重新分配.
+// Parameters:
+// - r: 新请求的 http.Request.
+func (m *FargoInput) Reset(r *http.Request) {
+	m.CruSession = nil
+	if m.Params == nil {
+		m.Params = make(map[string]string)
+	}
+	for k := range m.Params {
+		delete(m.Params, k)
+	}
+	m.ParamValues = nil
+	m.APIVersion = ""
+	if m.Data == nil {
+		m.Data = make(map[interface{}]interface{})
+	}
+	for k := range m.Data {
+		delete(m.Data, k)
+	}
+	m.Request = r
+	m.RequestBody = nil
+}
+
 // Protocol 获得使用的 HTTP 协议, 如 HTTP/1.1.
 // Return:
 //  - protocol: 协议.
@@ -69,10 +98,14 @@ func (m *FargoInput) Site() (site string) {
 	return m.Scheme() + "://" + m.Domain()
 }
 
-// Scheme 请求的 http 传输协议, 例如 “http” 或者 “https”.
+// Scheme 请求的 http 传输协议, 例如 “http” 或者 “https”,
+// 直接连接的地址是受信任的代理时使用 Forwarded 或者 X-Forwarded-Proto 中客户端请求的协议.
 // Return:
 //  - scheme: http 传输协议.
 func (m *FargoInput) Scheme() (scheme string) {
+	if hop, ok := m.forwarded(); ok && hop.proto != "" {
+		return strings.ToLower(hop.proto)
+	}
 	if m.Request.URL.Scheme != "" {
 		return m.Request.URL.Scheme
 	} else if m.Request.TLS == nil {
@@ -89,16 +122,18 @@ func (m *FargoInput) Domain() (domain string) {
 	return m.Host()
 }
 
-// Host 请求的域名, 和 domain 一样.
+// Host 请求的域名, 和 domain 一样,
+// 直接连接的地址是受信任的代理时使用 Forwarded 或者 X-Forwarded-Host 中客户端请求的域名.
 // Return:
 //  - host: 请求的域名.
 func (m *FargoInput) Host() (host string) {
+	if hop, ok := m.forwarded(); ok && hop.host != "" {
+		host, _ = splitHostPort(hop.host)
+		return
+	}
 	if m.Request.Host != "" {
-		hostParts := strings.Split(m.Request.Host, ":")
-		if len(hostParts) > 0 {
-			return hostParts[0]
-		}
-		return m.Request.Host
+		host, _ = splitHostPort(m.Request.Host)
+		return
 	}
 
 	return "localhost"
@@ -125,7 +160,7 @@ func (m *FargoInput) IsAjax() (is bool) {
 	return m.Header("X-Requested-With") == "XMLHttpRequest"
 }
 
-// IsSecure 判断当前请求是否 HTTPS 请求, 是返回 true, 否返回 false.
+// IsSecure 判断当前请求是否 HTTPS 请求, 是返回 true, 否返回 false, 和 Scheme 一样只信任受信任的代理的 header.
 // Return:
 //  - is: 是否 HTTPS 请求.
 func (m *FargoInput) IsSecure() (is bool) {
@@ -146,30 +181,37 @@ func (m *FargoInput) IsUpload() (is bool) {
 	return m.Request.MultipartForm != nil
 }
 
-// IP 返回请求用户的 IP, 如果用户通过代理, 一层一层剥离获取真实的 IP.
+// IP 返回请求用户的 IP, 直接连接的地址是受信任的代理([web] trustedproxies)时,
+// 从右向左剥离 Forwarded 或者 X-Forwarded-For 中受信任的代理获取真实的 IP, 否则为直接连接的地址.
 // Return:
 //  - ip: ip 地址, string 类型.
 func (m *FargoInput) IP() (ip string) {
-	ips := m.Proxy()
-	if len(ips) > 0 && ips[0] != "" {
-		return ips[0]
-	}
-	ipS := strings.Split(m.Request.RemoteAddr, ":")
-	if len(ipS) > 0 {
-		if ipS[0] != "[" {
-			return ipS[0]
+	if hop, ok := m.forwarded(); ok {
+		if clientIP := parseHopIP(hop.addr); clientIP != nil {
+			return clientIP.String()
 		}
 	}
+	if peer := parseHopIP(m.Request.RemoteAddr); peer != nil {
+		return peer.String()
+	}
 
 	return "127.0.0.1"
 }
 
-// Proxy 返回用户代理请求的所有 IP.
+// Proxy 返回用户代理请求的所有 IP, 即 X-Forwarded-For 的内容,
+// 直接连接的地址不是受信任的代理时 header 可能被伪造, 返回空.
 // Return:
 //  - proxy: 所有代理集合.
 func (m *FargoInput) Proxy() (proxy []string) {
+	if peer := parseHopIP(m.Request.RemoteAddr); peer == nil || !isTrustedProxy(peer) {
+		return []string{}
+	}
 	if ips := m.Header("X-Forwarded-For"); ips != "" {
-		return strings.Split(ips, ",")
+		proxy = strings.Split(ips, ",")
+		for i := range proxy {
+			proxy[i] = strings.TrimSpace(proxy[i])
+		}
+		return
 	}
 
 	return []string{}
@@ -296,15 +338,28 @@ func (m *FargoInput) SubDomains() (subdomain string) {
 	return strings.Join(parts[len(parts)-2:], ".")
 }
 
-// Port 返回请求的端口, 例如返回 8080.
+// Port 返回请求的端口, 例如返回 8080, 直接连接的地址是受信任的代理时使用 X-Forwarded-Port 或者转发的 host 中的端口,
+// 没有端口时 https 为 443, http 为 80.
 // Return:
 //  - port: 端口.
 func (m *FargoInput) Port() (port int) {
-	parts := strings.Split(m.Request.Host, ":")
-	if len(parts) == 2 {
-		port, _ = strconv.Atoi(parts[1])
+	hostport := m.Request.Host
+	if hop, ok := m.forwarded(); ok {
+		if hop.port != "" {
+			port, _ = strconv.Atoi(hop.port)
+			return
+		}
+		if hop.host != "" {
+			hostport = hop.host
+		}
+	}
+	if _, p := splitHostPort(hostport); p != "" {
+		port, _ = strconv.Atoi(p)
 		return
 	}
+	if m.IsSecure() {
+		return 443
+	}
 
 	return 80
 }
@@ -316,6 +371,14 @@ func (m *FargoInput) UserAgent() (useragent string) {
 	return m.Header("User-Agent")
 }
 
+// Version 返回请求的 API 版本, 来自 url 前缀 /v2, X-API-Version header 或者 Accept: application/vnd.app.v2+json,
+// 都没有时为默认版本.
+// Return:
+//  - version: API 版本, 如 v2, 没有版本时为空.
+func (m *FargoInput) Version() (version string) {
+	return m.APIVersion
+}
+
 // Param 在路由设置的时候可以设置参数, 这个是用来获取那些参数的, 例如 Param(":id"), 返回12.
 // Return:
 //  - Param: 参数.
@@ -327,6 +390,26 @@ func (m *FargoInput) Param(key string) (param string) {
 	return ""
 }
 
+// ParamValue 获取带类型的路由参数转换之后的值, 例如路由 /user/:id:int64, ParamValue(":id").(int64).
+// Parameters:
+//  - key:   参数名称, 如 :id.
+// Return:
+//  - value: 转换之后的值, 参数不存在或者没有类型时为 nil.
+func (m *FargoInput) ParamValue(key string) (value interface{}) {
+	return m.ParamValues[key]
+}
+
+// SetParamValue 设置带类型的路由参数转换之后的值.
+// Parameters:
+//  - key:   参数名称, 如 :id.
+//  - value: 转换之后的值.
+func (m *FargoInput) SetParamValue(key string, value interface{}) {
+	if m.ParamValues == nil {
+		m.ParamValues = make(map[string]interface{})
+	}
+	m.ParamValues[key] = value
+}
+
 // Query 该函数返回 Get 请求和 Post 请求中的所有数据, 和 PHP 中 $_REQUEST 类似.
 // Parameters:
 //  - key:   key 值
@@ -351,6 +434,78 @@ func (m *FargoInput) Header(key string) (header string) {
 	return m.Request.Header.Get(key)
 }
 
+// formatMediaTypes 输出格式对应的 media type, 用于 Negotiate.
+var formatMediaTypes = map[string][]string{
+	"json":  {"application/json", "text/json"},
+	"xml":   {"application/xml", "text/xml"},
+	"yaml":  {"application/x-yaml", "application/yaml", "text/yaml", "text/x-yaml"},
+	"html":  {"text/html", "application/xhtml+xml"},
+	"jsonp": {"application/javascript", "text/javascript"},
+}
+
+// Negotiate 根据 Accept header 从 offers 中选择 q 值最高的输出格式, q 值相同时取 Accept 中靠前的,
+// 支持 application/vnd.app.v2+json 形式的后缀以及 */*, text/* 形式的通配符.
+// 例如 Accept: application/xml;q=0.9, application/json 时, Negotiate("json", "xml") 返回 json.
+// Parameters:
+//  - offers: 可以输出的格式, 如 json, xml, yaml, html, jsonp.
+// Return:
+//  - format: 选择的格式, 没有 Accept header 时为 offers[0], 没有可以接受的格式时为空.
+func (m *FargoInput) Negotiate(offers ...string) (format string) {
+	accept := m.Header("Accept")
+	if len(offers) == 0 || strings.TrimSpace(accept) == "" {
+		if len(offers) > 0 {
+			format = offers[0]
+		}
+		return
+	}
+
+	best := 0.0
+	for _, spec := range strings.Split(accept, ",") {
+		q := 1.0
+		parts := strings.Split(spec, ";")
+		media := strings.ToLower(strings.TrimSpace(parts[0]))
+		for _, p := range parts[1:] {
+			if p = strings.TrimSpace(p); strings.HasPrefix(p, "q=") {
+				if v, err := strconv.ParseFloat(p[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q <= best {
+			continue
+		}
+		for _, offer := range offers {
+			if matchMediaType(media, offer) {
+				format, best = offer, q
+				break
+			}
+		}
+	}
+
+	return
+}
+
+// matchMediaType Accept 中的 media type 是否接受输出格式 format.
+func matchMediaType(media, format string) bool {
+	types := formatMediaTypes[format]
+	if len(types) == 0 {
+		return false
+	}
+	if media == "*/*" || media == "*" {
+		return true
+	}
+	if strings.HasSuffix(media, "/*") {
+		return strings.HasPrefix(types[0], media[:len(media)-1])
+	}
+	for _, t := range types {
+		if media == t {
+			return true
+		}
+	}
+	// 如 application/vnd.app.v2+json.
+	return format != "jsonp" && strings.HasSuffix(media, "+"+format)
+}
+
 // Cookie 返回请求中的 cookie 数据, 例如 Cookie("username"), 就可以获取请求头中携带的 cookie 信息中 username 对应的值.
 // Parameters:
 //  - key:    key 值
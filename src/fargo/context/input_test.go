@@ -0,0 +1,79 @@
+package context
+
+import (
+	"net"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSetTrustedProxies(t *testing.T) {
+	defer SetTrustedProxies(nil)
+
+	cases := []struct {
+		cidrs   []string
+		ok      bool
+		trusted []string
+	}{
+		{[]string{"10.0.0.0/8", " ::1", ""}, true, []string{"10.1.2.3", "::1"}},
+		{[]string{"127.0.0.1"}, true, []string{"127.0.0.1", "::ffff:127.0.0.1"}},
+		{[]string{"10.0.0.0/8", "bad"}, false, []string{"127.0.0.1"}},
+		{[]string{"10.0.0.0/33"}, false, []string{"127.0.0.1"}},
+		{nil, true, nil},
+	}
+	for i, c := range cases {
+		if err := SetTrustedProxies(c.cidrs); (err == nil) != c.ok {
+			t.Errorf("case %d: expect ok %v, got %v", i, c.ok, err)
+		}
+		for _, ip := range c.trusted {
+			if !isTrustedProxy(net.ParseIP(ip)) {
+				t.Errorf("case %d: expect %s trusted", i, ip)
+			}
+		}
+		if isTrustedProxy(net.ParseIP("1.2.3.4")) {
+			t.Errorf("case %d: expect 1.2.3.4 not trusted", i)
+		}
+	}
+}
+
+func TestTrustedProxies(t *testing.T) {
+	if err := SetTrustedProxies([]string{"10.0.0.0/8", " ::1"}); err != nil {
+		t.Fatal(err)
+	}
+	defer SetTrustedProxies(nil)
+
+	cases := []struct {
+		remote  string
+		headers map[string]string
+		ip      string
+		scheme  string
+		host    string
+		port    int
+	}{
+		// 不受信任的地址, header 被忽略.
+		{"1.2.3.4:5000", map[string]string{"X-Forwarded-For": "9.9.9.9", "X-Forwarded-Proto": "https", "X-Forwarded-Host": "evil.com"},
+			"1.2.3.4", "http", "example.com", 80},
+		// 从右向左跳过受信任的代理, 客户端伪造的最左边的地址被忽略.
+		{"10.0.0.2:5000", map[string]string{"X-Forwarded-For": "9.9.9.9, 1.2.3.4, 10.0.0.1", "X-Forwarded-Proto": "https", "X-Forwarded-Host": "app.com"},
+			"1.2.3.4", "https", "app.com", 443},
+		{"[::1]:5000", map[string]string{"X-Forwarded-For": "1.2.3.4", "X-Forwarded-Port": "8443", "X-Forwarded-Proto": "https"},
+			"1.2.3.4", "https", "example.com", 8443},
+		// Forwarded 优先于 X-Forwarded-*.
+		{"10.0.0.2:5000", map[string]string{"Forwarded": `for=1.2.3.4;proto=https;host="app.com:8080", for="[2001:db8::1]:4711"`, "X-Forwarded-For": "5.6.7.8"},
+			"2001:db8::1", "http", "example.com", 80},
+		{"10.0.0.2:5000", map[string]string{"Forwarded": `for=1.2.3.4;proto=https;host="app.com:8080", for=10.1.1.1`},
+			"1.2.3.4", "https", "app.com", 8080},
+		{"10.0.0.2:5000", map[string]string{"Forwarded": `for=unknown;proto=https`},
+			"10.0.0.2", "https", "example.com", 443},
+	}
+	for i, c := range cases {
+		r := httptest.NewRequest("GET", "http://example.com/", nil)
+		r.RemoteAddr = c.remote
+		for k, v := range c.headers {
+			r.Header.Set(k, v)
+		}
+		in := NewInput(r)
+		if in.IP() != c.ip || in.Scheme() != c.scheme || in.Host() != c.host || in.Port() != c.port || in.IsSecure() != (c.scheme == "https") {
+			t.Errorf("case %d: expect %s %s %s %d, got %s %s %s %d", i, c.ip, c.scheme, c.host, c.port, in.IP(), in.Scheme(), in.Host(), in.Port())
+		}
+	}
+}
@@ -15,6 +15,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/pquerna/ffjson/ffjson"
 )
@@ -24,6 +25,16 @@ type FargoOutput struct {
 	Context    *Context
 	Status     int
 	EnableGzip bool
+
+	// status 是否已经输出.
+	statusWritten bool
+}
+
+// responseStats 记录输出状态的 http.ResponseWriter, 框架封装的 ResponseWriter 实现了这个接口.
+type responseStats interface {
+	Status() int
+	BytesWritten() int64
+	TimeToFirstByte() time.Duration
 }
 
 // NewOutput 新建一个 fargo 输出对象.
@@ -33,6 +44,13 @@ func NewOutput() (m *FargoOutput) {
 	return new(FargoOutput)
 }
 
+// Reset 重置输出对象以便复用, Context 保持不变.
+func (m *FargoOutput) Reset() {
+	m.Status = 0
+	m.EnableGzip = false
+	m.statusWritten = false
+}
+
 // Header 设置输出的 header 信息, 例如 Header("Server", "fargo").
 // Parameters:
 // - key: header key 值, 如 server.
@@ -69,6 +87,7 @@ func (m *FargoOutput) Body(content []byte) {
 	} else {
 		m.Header("Content-Length", strconv.Itoa(len(content)))
 	}
+	m.writeStatus()
 	outputWriter.Write(content)
 	switch outputWriter.(type) {
 	case *gzip.Writer:
@@ -79,6 +98,7 @@ func (m *FargoOutput) Body(content []byte) {
 }
 
 // Cookie 设置输出的 cookie 信息, 例如 Cookie("sessionID","fargoSessionID").
+// others 为 CookieOptions 或者 *CookieOptions 时使用其中的选项, 否则依次为 MaxAge, Path, Domain, Secure 以及 HttpOnly.
 // Parameters:
 // - name:   要设置的 cookie 的 key.
 // - value:  要设置的 cookie 的 值.
@@ -87,6 +107,16 @@ func (m *FargoOutput) Cookie(name string, value string, others ...interface{}) {
 	var b bytes.Buffer
 	fmt.Fprintf(&b, "%s=%s", sanitizeName(name), sanitizeValue(value))
 	if len(others) > 0 {
+		switch opts := others[0].(type) {
+		case CookieOptions:
+			opts.writeTo(&b)
+			m.Context.ResponseWriter.Header().Add("Set-Cookie", b.String())
+			return
+		case *CookieOptions:
+			opts.writeTo(&b)
+			m.Context.ResponseWriter.Header().Add("Set-Cookie", b.String())
+			return
+		}
 		switch others[0].(type) {
 		case int:
 			if others[0].(int) > 0 {
@@ -137,81 +167,139 @@ func sanitizeValue(v string) (sanitizer string) {
 	return cookieValueSanitizer.Replace(v)
 }
 
-// JSON 把 Data 格式化为 Json, 然后调用 Body 输出数据.
+// JSON 把 Data 格式化为 Json, 然后调用 Body 输出数据, 状态码为 SetStatus 设置的状态码, 没有设置时为 200.
 // Parameters:
 // - data:       要输出的数据.
 // - hasIndent:  marshal 的 时候是否需要 Indet.
 // - coding:     是否需要进行转码, 如 \\00 格式转换成字符串.
 func (m *FargoOutput) JSON(data interface{}, hasIndent bool, coding bool) (err error) {
-	m.Header("Content-Type", "application/json; charset=utf-8")
-	var content []byte
-	if hasIndent {
-		content, err = json.MarshalIndent(data, "", "  ")
-	} else {
-		content, err = ffjson.Marshal(data)
-	}
-	if err != nil {
-		http.Error(m.Context.ResponseWriter, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	if coding {
-		content = []byte(stringsToJSON(string(content)))
-	}
-	m.Body(content)
-
-	return
+	return m.serve(m.Status, "json", data, hasIndent, coding)
 }
 
-// Jsonp 把 Data 格式化为 Jsonp, 然后调用 Body 输出数据.
+// Jsonp 把 Data 格式化为 Jsonp, 然后调用 Body 输出数据, 状态码为 SetStatus 设置的状态码, 没有设置时为 200.
 // Parameters:
 // - data:       要输出的数据.
 // - hasIndent:  marshal 的 时候是否需要 Indet.
 func (m *FargoOutput) Jsonp(data interface{}, hasIndent bool) (err error) {
-	m.Header("Content-Type", "application/javascript;charset=UTF-8")
-	var content []byte
-	if hasIndent {
-		content, err = json.MarshalIndent(data, "", "  ")
-	} else {
-		content, err = ffjson.Marshal(data)
-	}
-	if err != nil {
-		http.Error(m.Context.ResponseWriter, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	callback := m.Context.Input.Query("callback")
-	if callback == "" {
-		return errors.New(`"callback" parameter required`)
-	}
-	callbackContent := bytes.NewBufferString(" " + template.JSEscapeString(callback))
-	callbackContent.WriteString("(")
-	callbackContent.Write(content)
-	callbackContent.WriteString(");\r\n")
-	m.Body(callbackContent.Bytes())
-
-	return
+	return m.serve(m.Status, "jsonp", data, hasIndent, false)
 }
 
-// XML 把 Data 格式化为 XML, 然后调用 Body 输出数据.
+// XML 把 Data 格式化为 XML, 然后调用 Body 输出数据, 状态码为 SetStatus 设置的状态码, 没有设置时为 200.
 // Parameters:
 // - data:       要输出的数据.
 // - hasIndent:  marshal 的 时候是否需要 Indet.
 func (m *FargoOutput) XML(data interface{}, hasIndent bool) (err error) {
-	m.Header("Content-Type", "application/xml;charset=UTF-8")
-	var content []byte
-	if hasIndent {
-		content, err = xml.MarshalIndent(data, "", "  ")
-	} else {
-		content, err = xml.Marshal(data)
+	return m.serve(m.Status, "xml", data, hasIndent, false)
+}
+
+// YAML 把 Data 格式化为 YAML, 然后调用 Body 输出数据, 状态码为 SetStatus 设置的状态码, 没有设置时为 200.
+// 字段名称以及忽略规则和 json tag 一致.
+// Parameters:
+// - data:  要输出的数据.
+func (m *FargoOutput) YAML(data interface{}) (err error) {
+	return m.serve(m.Status, "yaml", data, false, false)
+}
+
+// outputFormats 支持的输出格式对应的 Content-Type.
+var outputFormats = map[string]string{
+	"json":  "application/json; charset=utf-8",
+	"jsonp": "application/javascript;charset=UTF-8",
+	"xml":   "application/xml;charset=UTF-8",
+	"yaml":  "application/x-yaml; charset=utf-8",
+	"html":  "text/html; charset=utf-8",
+}
+
+// Serve 把 data 按照 format 格式化, 然后以 status 状态码调用 Body 输出数据, 格式化失败时输出 500.
+// 支持的格式有 json, jsonp, xml, yaml 以及 html, jsonp 需要 callback 参数, html 的 data 需要为 string 或者 []byte.
+// Parameters:
+// - status:    状态码, 为 0 时为 200.
+// - format:    输出的格式, 如 json.
+// - data:      要输出的数据.
+// - hasIndent: marshal 的 时候是否需要 Indet.
+// Return:
+// - err:       不支持的格式或者格式化失败.
+func (m *FargoOutput) Serve(status int, format string, data interface{}, hasIndent bool) (err error) {
+	return m.serve(status, format, data, hasIndent, false)
+}
+
+// serve 同 Serve, coding 同 JSON 的 coding 参数.
+func (m *FargoOutput) serve(status int, format string, data interface{}, hasIndent, coding bool) (err error) {
+	contentType, ok := outputFormats[format]
+	if !ok {
+		return fmt.Errorf("unsupported output format %s", format)
 	}
+	if format == "jsonp" && m.Context.Input.Query("callback") == "" {
+		return errors.New(`"callback" parameter required`)
+	}
+	content, err := m.marshal(format, data, hasIndent, coding)
 	if err != nil {
 		http.Error(m.Context.ResponseWriter, err.Error(), http.StatusInternalServerError)
 		return
 	}
+
+	m.Header("Content-Type", contentType)
+	if status != 0 {
+		m.Status = status
+	}
 	m.Body(content)
 
 	return
 }
 
+// marshal 把 data 按照 format 格式化.
+// Parameters:
+// - format:    输出的格式, 如 json.
+// - data:      要输出的数据.
+// - hasIndent: marshal 的 时候是否需要 Indet.
+// - coding:    是否需要进行转码, 如 \\00 格式转换成字符串.
+// Return:
+// - content:   格式化之后的内容.
+// - err:       格式化失败.
+func (m *FargoOutput) marshal(format string, data interface{}, hasIndent, coding bool) (content []byte, err error) {
+	switch format {
+	case "json", "jsonp":
+		if hasIndent {
+			content, err = json.MarshalIndent(data, "", "  ")
+		} else {
+			content, err = ffjson.Marshal(data)
+		}
+		if err != nil {
+			return
+		}
+		if coding {
+			content = []byte(stringsToJSON(string(content)))
+		}
+		if format == "jsonp" {
+			callbackContent := bytes.NewBufferString(" " + template.JSEscapeString(m.Context.Input.Query("callback")))
+			callbackContent.WriteString("(")
+			callbackContent.Write(content)
+			callbackContent.WriteString(");\r\n")
+			content = callbackContent.Bytes()
+		}
+	case "xml":
+		if hasIndent {
+			content, err = xml.MarshalIndent(data, "", "  ")
+		} else {
+			content, err = xml.Marshal(data)
+		}
+	case "yaml":
+		content, err = marshalYAML(data)
+	case "html":
+		switch data := data.(type) {
+		case []byte:
+			content = data
+		case string:
+			content = []byte(data)
+		case template.HTML:
+			content = []byte(data)
+		default:
+			err = fmt.Errorf("html output requires string or []byte, got %T", data)
+		}
+	}
+
+	return
+}
+
 // Download 把 file 路径传递进来, 然后输出文件给用户.
 // Parameters:
 // - file:  文件路径.
@@ -243,80 +331,138 @@ func (m *FargoOutput) ContentType(ext string) {
 // Parameters:
 // - status:  状态码.
 func (m *FargoOutput) SetStatus(status int) {
-	m.Context.ResponseWriter.WriteHeader(status)
 	m.Status = status
+	m.writeStatus()
+}
+
+// writeStatus 输出 status 状态码, 每个请求只输出一次, 没有设置 status 时由第一次 Write 输出 200.
+func (m *FargoOutput) writeStatus() {
+	if m.Status != 0 && !m.statusWritten {
+		m.Context.ResponseWriter.WriteHeader(m.Status)
+		m.statusWritten = true
+	}
+}
+
+// ResponseStatus 返回已经输出的状态码, 包括 controller, 错误页面以及 http.Error 等直接写入 ResponseWriter 的输出,
+// 只写入 body 时为 200, 还没有输出时为 Status, 即 SetStatus 设置的状态码, 都没有时为 0.
+// 可以在 AFTER_EXEC 以及 FINISH_ROUTER 的过滤函数中使用, 如统计 5xx 的比例.
+// Return:
+//  - status: 状态码.
+func (m *FargoOutput) ResponseStatus() (status int) {
+	if w, ok := m.Context.ResponseWriter.(responseStats); ok {
+		if status = w.Status(); status != 0 {
+			return
+		}
+	}
+	return m.Status
+}
+
+// BytesWritten 返回已经写入 response body 的字节数, 开启压缩时为压缩之后的字节数.
+// Return:
+//  - n: 字节数.
+func (m *FargoOutput) BytesWritten() (n int64) {
+	if w, ok := m.Context.ResponseWriter.(responseStats); ok {
+		return w.BytesWritten()
+	}
+	return
+}
+
+// TimeToFirstByte 返回从请求开始到第一次输出 header 或者 body 的时间, 还没有输出时为 0.
+// Return:
+//  - ttfb: 首字节时间.
+func (m *FargoOutput) TimeToFirstByte() (ttfb time.Duration) {
+	if w, ok := m.Context.ResponseWriter.(responseStats); ok {
+		return w.TimeToFirstByte()
+	}
+	return
+}
+
+// statusOr 返回 status, 为 0 时返回当前请求的状态码 ResponseStatus.
+func (m *FargoOutput) statusOr(status int) int {
+	if status == 0 {
+		return m.ResponseStatus()
+	}
+	return status
 }
 
 // IsCachable 根据 status 判断，是否为缓存类的状态, 200, 300, 304 则为可缓存状态.
 // Parameters:
-// - status:  状态码.
+// - status:  状态码, 为 0 时使用当前请求的状态码 ResponseStatus.
 // Return:
 //  - is:     是否可以缓存.
 func (m *FargoOutput) IsCachable(status int) (is bool) {
-	return m.Status >= 200 && m.Status < 300 || m.Status == 304
+	status = m.statusOr(status)
+	return status >= 200 && status < 300 || status == 304
 }
 
 // IsEmpty 根据 status 判断，是否为空的状态, 201, 204, 304 则为内容为空的状态.
 // Parameters:
-// - status:  状态码.
+// - status:  状态码, 为 0 时使用当前请求的状态码 ResponseStatus.
 // Return:
 //  - is:     是否为空.
 func (m *FargoOutput) IsEmpty(status int) (is bool) {
-	return m.Status == 201 || m.Status == 204 || m.Status == 304
+	status = m.statusOr(status)
+	return status == 201 || status == 204 || status == 304
 }
 
 // IsOk 根据 status 判断，是否为 200 的状态.
 // Parameters:
-// - status:  状态码.
+// - status:  状态码, 为 0 时使用当前请求的状态码 ResponseStatus.
 // Return:
 //  - is:     是否为200.
 func (m *FargoOutput) IsOk(status int) (is bool) {
-	return m.Status == 200
+	status = m.statusOr(status)
+	return status == 200
 }
 
 // IsSuccessful 根据 status 判断，是否为正常的状态, 为 2xx 状态.
 // Parameters:
-// - status:  状态码.
+// - status:  状态码, 为 0 时使用当前请求的状态码 ResponseStatus.
 // Return:
 //  - is:     是否正常.
 func (m *FargoOutput) IsSuccessful(status int) (is bool) {
-	return m.Status >= 200 && m.Status < 300
+	status = m.statusOr(status)
+	return status >= 200 && status < 300
 }
 
 // IsRedirect 根据 status 判断，是否为跳转的状态, 为 301, 302, 303 或者 307.
 // Parameters:
-// - status:  状态码.
+// - status:  状态码, 为 0 时使用当前请求的状态码 ResponseStatus.
 // Return:
 //  - is:     是否跳转.
 func (m *FargoOutput) IsRedirect(status int) (is bool) {
-	return m.Status == 301 || m.Status == 302 || m.Status == 303 || m.Status == 307
+	status = m.statusOr(status)
+	return status == 301 || status == 302 || status == 303 || status == 307
 }
 
 // IsForbidden 根据 status 判断，是否为403.
 // Parameters:
-// - status:  状态码.
+// - status:  状态码, 为 0 时使用当前请求的状态码 ResponseStatus.
 // Return:
 //  - is:     是否403.
 func (m *FargoOutput) IsForbidden(status int) (is bool) {
-	return m.Status == 403
+	status = m.statusOr(status)
+	return status == 403
 }
 
 // IsNotFound 根据 status 判断，是否为404.
 // Parameters:
-// - status:  状态码.
+// - status:  状态码, 为 0 时使用当前请求的状态码 ResponseStatus.
 // Return:
 //  - is:     是否404.
 func (m *FargoOutput) IsNotFound(status int) (is bool) {
-	return m.Status == 404
+	status = m.statusOr(status)
+	return status == 404
 }
 
 // IsClientError 根据 status 判断，客户端是否出现错误, 如 4xx, 5xx.
 // Parameters:
-// - status:  状态码.
+// - status:  状态码, 为 0 时使用当前请求的状态码 ResponseStatus.
 // Return:
 //  - is:     是否客户端是否出现错误.
 func (m *FargoOutput) IsClientError(status int) (is bool) {
-	return m.Status >= 400 && m.Status < 600
+	status = m.statusOr(status)
+	return status >= 400 && status < 600
 }
 
 // stringsToJson 将 json string 类型转换成 json 类型, 即将含有 /x33 的转换成 33 类型的.
@@ -0,0 +1,192 @@
+package context
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// trustedProxies 受信任的代理网段, 只有直接连接的地址在其中时才使用 Forwarded 和 X-Forwarded-* header.
+var trustedProxies []*net.IPNet
+
+// SetTrustedProxies 设置受信任的代理, 对应配置 [web] trustedproxies, 为空时不信任任何代理.
+// IP, Scheme, Host, Port 以及 IsSecure 只在直接连接的地址是受信任的代理时使用 Forwarded 和 X-Forwarded-* header.
+// Parameters:
+// - cidrs: 代理的网段或者 ip, 如 10.0.0.0/8, 127.0.0.1, ::1.
+// Return:
+// - err:   网段或者 ip 格式错误, 此时不修改已有的设置.
+func SetTrustedProxies(cidrs []string) (err error) {
+	var nets []*net.IPNet
+	for _, cidr := range cidrs {
+		if cidr = strings.TrimSpace(cidr); cidr == "" {
+			continue
+		}
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return fmt.Errorf("invalid trusted proxy %q", cidr)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return fmt.Errorf("invalid trusted proxy %q: %v", cidr, err)
+		}
+		nets = append(nets, ipnet)
+	}
+	trustedProxies = nets
+
+	return
+}
+
+// isTrustedProxy ip 是否为受信任的代理.
+func isTrustedProxy(ip net.IP) bool {
+	for _, ipnet := range trustedProxies {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedHop 代理链中的一跳, 即一个代理收到的请求.
+type forwardedHop struct {
+	// 连接到代理的地址.
+	addr string
+
+	// 代理收到请求时的协议, 如 https.
+	proto string
+
+	// 代理收到请求时的 host, 可能带有端口.
+	host string
+
+	// 代理收到请求时的端口, 来自 X-Forwarded-Port.
+	port string
+}
+
+// forwarded 获取客户端请求对应的一跳, 直接连接的地址不是受信任的代理时不使用任何 header.
+// 从右向左遍历代理链, 跳过受信任的代理, 第一个不受信任或者无法解析的地址即为客户端.
+// 含有 Forwarded header 时只使用 Forwarded, 否则使用 X-Forwarded-For, -Proto, -Host 以及 -Port.
+// Return:
+// - hop: 客户端请求对应的一跳.
+// - ok:  是否使用了代理的 header.
+func (m *FargoInput) forwarded() (hop forwardedHop, ok bool) {
+	if peer := parseHopIP(m.Request.RemoteAddr); peer == nil || !isTrustedProxy(peer) {
+		return
+	}
+
+	var hops []forwardedHop
+	if values := m.Request.Header["Forwarded"]; len(values) > 0 {
+		hops = parseForwarded(values)
+	} else {
+		hops = m.xForwarded()
+	}
+	if len(hops) == 0 {
+		return
+	}
+
+	i := len(hops) - 1
+	for ; i > 0; i-- {
+		if ip := parseHopIP(hops[i].addr); ip == nil || !isTrustedProxy(ip) {
+			break
+		}
+	}
+
+	return hops[i], true
+}
+
+// xForwarded 按照从右向左对齐的方式将 X-Forwarded-* header 组合成代理链,
+// 某个 header 的值少于代理链长度时, 左边缺少的部分使用其最左边的值.
+func (m *FargoInput) xForwarded() (hops []forwardedHop) {
+	lists := make([][]string, 4)
+	n := 0
+	for i, key := range []string{"X-Forwarded-For", "X-Forwarded-Proto", "X-Forwarded-Host", "X-Forwarded-Port"} {
+		for _, value := range m.Request.Header[key] {
+			for _, v := range strings.Split(value, ",") {
+				lists[i] = append(lists[i], strings.TrimSpace(v))
+			}
+		}
+		if len(lists[i]) > n {
+			n = len(lists[i])
+		}
+	}
+
+	hops = make([]forwardedHop, n)
+	at := func(list []string, i int) string {
+		if len(list) == 0 {
+			return ""
+		}
+		if i -= n - len(list); i < 0 {
+			i = 0
+		}
+		return list[i]
+	}
+	for i := range hops {
+		hops[i] = forwardedHop{
+			addr:  at(lists[0], i),
+			proto: at(lists[1], i),
+			host:  at(lists[2], i),
+			port:  at(lists[3], i),
+		}
+	}
+
+	return
+}
+
+// parseForwarded 解析 RFC 7239 Forwarded header, 如 for=192.0.2.43;proto=https;host=example.com, for="[2001:db8::1]:4711".
+func parseForwarded(values []string) (hops []forwardedHop) {
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			var hop forwardedHop
+			for _, pair := range strings.Split(element, ";") {
+				i := strings.Index(pair, "=")
+				if i == -1 {
+					continue
+				}
+				v := strings.TrimSpace(pair[i+1:])
+				if unquoted, err := strconv.Unquote(v); err == nil {
+					v = unquoted
+				}
+				switch strings.ToLower(strings.TrimSpace(pair[:i])) {
+				case "for":
+					hop.addr = v
+				case "proto":
+					hop.proto = v
+				case "host":
+					hop.host = v
+				}
+			}
+			hops = append(hops, hop)
+		}
+	}
+
+	return
+}
+
+// parseHopIP 解析代理链中的地址, 可能带有端口, 如 192.0.2.43:47011, [2001:db8::1]:4711,
+// unknown 以及 _hidden 等混淆的标识返回 nil.
+func parseHopIP(addr string) net.IP {
+	addr = strings.TrimSpace(addr)
+	if strings.HasPrefix(addr, "[") {
+		if i := strings.Index(addr, "]"); i != -1 {
+			addr = addr[1:i]
+		}
+	} else if strings.Count(addr, ":") == 1 {
+		addr = addr[:strings.Index(addr, ":")]
+	}
+	return net.ParseIP(addr)
+}
+
+// splitHostPort 拆分 host 和端口, 支持 [::1]:8080 格式, 没有端口时 port 为空.
+func splitHostPort(hostport string) (host, port string) {
+	if h, p, err := net.SplitHostPort(hostport); err == nil {
+		return h, p
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(hostport, "["), "]"), ""
+}
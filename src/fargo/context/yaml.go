@@ -0,0 +1,114 @@
+package context
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// yamlPlainRegexp 不需要加引号的 YAML 字符串.
+var yamlPlainRegexp = regexp.MustCompile(`^[A-Za-z_/\p{Han}][^:#\n\r\t'"]*$`)
+
+// yamlReserved 作为字符串输出时需要加引号的 YAML 关键字.
+var yamlReserved = map[string]bool{
+	"true": true, "false": true, "yes": true, "no": true, "on": true, "off": true,
+	"y": true, "n": true, "null": true, "~": true,
+}
+
+// marshalYAML 将 data 格式化为块格式的 YAML, 字段名称以及忽略规则和 json tag 一致, map 的 key 按照字典序输出.
+// Parameters:
+// - data:    要格式化的数据.
+// Return:
+// - content: YAML 内容.
+// - err:     data 无法被 json 格式化.
+func marshalYAML(data interface{}) (content []byte, err error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var v interface{}
+	if err = d.Decode(&v); err != nil {
+		return
+	}
+
+	var buf bytes.Buffer
+	for _, line := range yamlLines(v, "") {
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+// yamlLines 将 json 解析之后的值转换成 YAML 的每一行.
+// Parameters:
+// - v:      json 解析之后的值.
+// - indent: 当前的缩进.
+// Return:
+// - lines:  YAML 的每一行, 已经带有缩进.
+func yamlLines(v interface{}, indent string) (lines []string) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 {
+			return []string{indent + "{}"}
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if yamlComposite(v[k]) {
+				lines = append(lines, indent+yamlScalar(k)+":")
+				lines = append(lines, yamlLines(v[k], indent+"  ")...)
+			} else {
+				lines = append(lines, indent+yamlScalar(k)+": "+yamlLines(v[k], "")[0])
+			}
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			return []string{indent + "[]"}
+		}
+		for _, item := range v {
+			sub := yamlLines(item, indent+"  ")
+			sub[0] = indent + "- " + strings.TrimPrefix(sub[0], indent+"  ")
+			lines = append(lines, sub...)
+		}
+	case nil:
+		lines = []string{indent + "null"}
+	case bool:
+		lines = []string{indent + strconv.FormatBool(v)}
+	case json.Number:
+		lines = []string{indent + v.String()}
+	case string:
+		lines = []string{indent + yamlScalar(v)}
+	default:
+		lines = []string{indent + yamlScalar(fmt.Sprint(v))}
+	}
+
+	return
+}
+
+// yamlComposite 是否为非空的 map 或者切片, 需要换行输出.
+func yamlComposite(v interface{}) bool {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return len(v) > 0
+	case []interface{}:
+		return len(v) > 0
+	}
+	return false
+}
+
+// yamlScalar 输出 YAML 字符串, 可能被解析成其他类型或者含有特殊字符时加上双引号.
+func yamlScalar(s string) string {
+	if yamlPlainRegexp.MatchString(s) && !yamlReserved[strings.ToLower(s)] && strings.TrimSpace(s) == s {
+		return s
+	}
+	return strconv.Quote(s)
+}
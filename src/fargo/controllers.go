@@ -6,6 +6,7 @@ import (
 	"crypto/hmac"
 	"crypto/sha1"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
@@ -22,6 +23,7 @@ import (
 	"bdlib/util"
 	"fargo/context"
 	"fargo/middleware"
+	"fargo/session"
 )
 
 // Controller 每一个路由的控制层对象, 将在应用的 controller 中被继承, 作为逻辑操作实体.
@@ -94,7 +96,7 @@ type ControllerInterface interface {
 	Render() error
 	XsrfToken() string
 	CheckXSRFCookie() bool
-	accessLog(reqTime time.Duration, reqUnix int64)
+	accessLogInfo() string
 }
 
 // Init 控制层初始化.
@@ -107,22 +109,31 @@ type ControllerInterface interface {
 //  - app:           fargo 对象.
 func (c *Controller) Init(ctx *context.Context, ControllerName, actionName string, app interface{}) {
 	c.Ctx = ctx
-	c.Data = make(map[interface{}]interface{})
+	// 从 pool 中获取的 controller 保留了清空之后的 Data 和 LayoutSections, 不需要重新分配.
+	if c.Data == nil {
+		c.Data = make(map[interface{}]interface{})
+	}
 	c.controllerName = ControllerName
 	c.actionName = actionName
 	c.TplNames = ""
 	c.TplPrefix = ""
 	c.TplExt = "html"
 	c.Layout = ""
-	c.LayoutSections = make(map[string]string)
+	if c.LayoutSections == nil {
+		c.LayoutSections = make(map[string]string)
+	}
 	c.XSRFExpire = XSRFExpire
-	c.Data = ctx.Input.Data
 	c.EnableReander = true
 	c.AppController = app
 	c.Loger = Log
 	c.Cfg = gCfg
 }
 
+// base 返回 controller 嵌入的 Controller, 放回 pool 时用于保留 Data 和 LayoutSections.
+func (c *Controller) base() *Controller {
+	return c
+}
+
 // Prepare 每一个请求到来之后处理到 Get、Post 等方法之前执行, 用于 ip 限制、黑白名单等限制工作.
 func (c *Controller) Prepare() {
 
@@ -139,39 +150,9 @@ func (c *Controller) Finish() {
 
 }
 
-// accessLog 记录 access log.
-func (c *Controller) accessLog(reqTime time.Duration, reqUnix int64) {
-	// 客户端请求 ip.
-	ip := c.Ctx.Input.IP()
-	// http 请求状态.
-	//HTTPStatus := c.Ctx.Output.Status
-	// refer.
-	refer := c.Ctx.Input.Refer()
-	// host.
-	host := c.Ctx.Input.Host()
-	// system.
-	//system := c.Ctx.Input.System()
-	// browser.
-	//browser := c.Ctx.Input.Browser()
-	// user agent.
-	userAgent := c.Ctx.Input.UserAgent()
-	// language.
-	//lang := c.Ctx.Input.Header("Accept-Language")
-	// method.
-	method := c.Ctx.Input.Method()
-	// uRL.
-	uRL := c.Ctx.Input.URL()
-
-	var buf bytes.Buffer
-	fmt.Fprintf(&buf, "ACCESS_INFO: %s %s %s %s %s %s", ip, uRL, host, method, refer, userAgent)
-	if c.Accesslog == "" {
-		Log.PrintfN(2, "%s %s", buf.String(), reqTime.String())
-	} else {
-		Log.PrintfN(2, "%s %s %s", buf.String(), c.Accesslog, reqTime.String())
-	}
-
-	c.Data["fargo_req_time"] = reqTime.String()
-	c.Data["fargo_req_now"] = reqUnix
+// accessLogInfo 返回加入到 access log 中的日志, 即 Accesslog.
+func (c *Controller) accessLogInfo() string {
+	return c.Accesslog
 }
 
 // Get 将 GET 请求处理到对应的控制层上的 Get 方法上.
@@ -321,6 +302,40 @@ func (c *Controller) RenderBytes() (tpl []byte, err error) {
 	return icontent, nil
 }
 
+// Serve 根据 Accept header 以及 runmode 选择输出格式, 以 status 状态码输出 data.
+// runmode 为 api 时可选的格式依次为 json, xml, yaml, 其他模式下为 html, json, xml, yaml,
+// 没有 Accept header 或者没有可以接受的格式时使用第一个格式, 请求中带有 callback 参数时输出 jsonp.
+// html 格式将 data 设置到 Data["Data"] 中, 然后渲染 controller 的模板.
+// 例如 c.Serve(201, user), Accept: application/xml 时输出 xml, Accept: application/json 时输出 json.
+// Parameters:
+// - status: 状态码, 如 200, 201 等.
+// - data:   要输出的数据.
+// Return:
+// - err:    格式化或者渲染模板失败.
+func (c *Controller) Serve(status int, data interface{}) (err error) {
+	offers := []string{"html", "json", "xml", "yaml"}
+	if runMode == "api" {
+		offers = offers[1:]
+	}
+	format := c.Ctx.Input.Negotiate(offers...)
+	if format == "" {
+		format = offers[0]
+	}
+	if c.Ctx.Input.Query("callback") != "" {
+		format = "jsonp"
+	}
+
+	if format == "html" {
+		c.Data["Data"] = data
+		if data, err = c.RenderBytes(); err != nil {
+			http.Error(c.Ctx.ResponseWriter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	return c.Ctx.Output.Serve(status, format, data, false)
+}
+
 // Redirect 通过给定的状态码(301, 302, etc.) 跳转到指定的 url.
 // Parameters:
 // - url:  跳转 url.
@@ -329,6 +344,33 @@ func (c *Controller) Redirect(url string, code int) {
 	c.Ctx.Redirect(code, url)
 }
 
+// Abort 中止请求, 以 code 状态码输出 body, body 为空时输出 middleware.ErrorMaps 中对应的错误页面,
+// 之后的代码不会执行, Finish 以及 AFTER_EXEC 的过滤函数仍然会执行, 如 c.Abort(403, "forbidden").
+// Parameters:
+// - code: 状态码, 如 403.
+// - body: 输出的内容.
+func (c *Controller) Abort(code int, body string) {
+	c.Ctx.Abort(code, body)
+}
+
+// StopRun 中止请求, 不再输出任何内容, 用于已经输出之后提前结束, Finish 以及 AFTER_EXEC 的过滤函数仍然会执行.
+func (c *Controller) StopRun() {
+	c.Ctx.StopRun()
+}
+
+// URLFor 通过路由名称或者 Controller.Method 反向生成 url, 同 fargo.URLFor.
+// Parameters:
+// - endpoint: 路由名称或者 Controller.Method, Controller 可以省略, 如 ".Get" 表示当前 controller 的 Get.
+// - values:   key, value 交替的参数.
+// Return:
+// - u:        生成的 url.
+func (c *Controller) URLFor(endpoint string, values ...interface{}) (u string) {
+	if strings.HasPrefix(endpoint, ".") {
+		endpoint = c.controllerName + endpoint
+	}
+	return URLFor(endpoint, values...)
+}
+
 // Input 从 request 中获取输入的参数, 如表单数据, url 参数等.
 // Return:
 // - input: 输入的参数, 如表单数据, url 参数等.
@@ -477,7 +519,91 @@ func (c *Controller) SaveToFile(fromfile, tofile string) (err error) {
 	return
 }
 
-// TODO session
+// errSessionOff 没有开启 session 或者 session 启动失败.
+var errSessionOff = errors.New("session is not enabled, set [web] sessionOn = true")
+
+// StartSession 启动 session, 已经启动时直接返回, 没有开启 session ([web] sessionOn) 时返回 nil.
+// web 模式下每个请求都会自动启动 session, api 模式下在第一次调用 session 相关的方法时启动.
+// Return:
+// - store: session 存储对象.
+func (c *Controller) StartSession() (store session.SessionStore) {
+	if c.Ctx.Input.CruSession == nil && sessionOn && globalSessions != nil {
+		c.Ctx.Input.CruSession = globalSessions.SessionStart(c.Ctx.ResponseWriter, c.Ctx.Request)
+	}
+	return c.Ctx.Input.CruSession
+}
+
+// SetSession 设置 session 中 name 对应的值.
+// Parameters:
+// - name:  key 值.
+// - value: 要设置的值.
+// Return:
+// - err:   没有开启 session 或者存储失败.
+func (c *Controller) SetSession(name, value interface{}) (err error) {
+	store := c.StartSession()
+	if store == nil {
+		return errSessionOff
+	}
+	return store.Set(name, value)
+}
+
+// GetSession 获取 session 中 name 对应的值, 没有开启 session 时返回 nil.
+// Parameters:
+// - name:   key 值.
+// Return:
+// - value:  session 中的值.
+func (c *Controller) GetSession(name interface{}) (value interface{}) {
+	store := c.StartSession()
+	if store == nil {
+		return
+	}
+	return store.Get(name)
+}
+
+// DelSession 删除 session 中 name 对应的值.
+// Parameters:
+// - name: key 值.
+// Return:
+// - err:  没有开启 session 或者删除失败.
+func (c *Controller) DelSession(name interface{}) (err error) {
+	store := c.StartSession()
+	if store == nil {
+		return errSessionOff
+	}
+	return store.Delete(name)
+}
+
+// SessionRegenerate 重新生成 session id 并保留 session 中的数据, 用于登录之后防止 session 固定攻击.
+// Return:
+// - err: 没有开启 session 或者重新生成失败.
+func (c *Controller) SessionRegenerate() (err error) {
+	if !sessionOn || globalSessions == nil {
+		return errSessionOff
+	}
+	store := globalSessions.SessionRegenerate(c.Ctx.ResponseWriter, c.Ctx.Request)
+	if store == nil {
+		return fmt.Errorf("session regenerate failed")
+	}
+	c.Ctx.Input.CruSession = store
+
+	return
+}
+
+// DestroySession 清空并销毁 session, 同时删除 session cookie, 之后再调用 session 相关的方法会启动一个新的 session.
+// Return:
+// - err: 没有开启 session 或者清空失败.
+func (c *Controller) DestroySession() (err error) {
+	if !sessionOn || globalSessions == nil {
+		return errSessionOff
+	}
+	if store := c.StartSession(); store != nil {
+		err = store.Flush()
+	}
+	globalSessions.SessionDestroy(c.Ctx.ResponseWriter, c.Ctx.Request)
+	c.Ctx.Input.CruSession = nil
+
+	return
+}
 
 // IsAjax 判断这个请求是否为 ajax 请求.
 func (c *Controller) IsAjax() (is bool) {
@@ -513,7 +639,8 @@ func (c *Controller) GetSecureCookie(secret, key string) (value string, ok bool)
 	return
 }
 
-// SetSecureCookie 设置加密编码之后的 value 到 cookie.
+// SetSecureCookie 设置加密编码之后的 value 到 cookie, 使用 HMAC-SHA1 签名并且没有加密,
+// 新的代码应当使用 SetSignedCookie 或者 SetEncryptedCookie.
 func (c *Controller) SetSecureCookie(secret, name, value string, age int64) {
 	vs := base64.URLEncoding.EncodeToString([]byte(value))
 	timestamp := strconv.FormatInt(time.Now().UnixNano(), 10)
@@ -528,6 +655,49 @@ func (c *Controller) SetSecureCookie(secret, name, value string, age int64) {
 	return
 }
 
+// SetSignedCookie 设置 HMAC-SHA256 签名的 cookie, 使用 [web] cookiekeys 中最新的 key 签名.
+// Parameters:
+// - name:   cookie 的名称.
+// - value:  cookie 的值.
+// - others: 同 Ctx.SetCookie, 可以为 context.CookieOptions.
+// Return:
+// - err:    没有配置 cookiekeys.
+func (c *Controller) SetSignedCookie(name, value string, others ...interface{}) (err error) {
+	return c.Ctx.SetSignedCookie(name, value, others...)
+}
+
+// GetSignedCookie 获取 SetSignedCookie 设置的 cookie, 使用旧的 key 签名的 cookie 仍然有效.
+// Parameters:
+// - name:   cookie 的名称.
+// - maxAge: 有效时间, 单位秒, 签名时间在 maxAge 秒之前的 cookie 无效, 为 0 时不检查.
+// Return:
+// - value:  cookie 的值.
+// - ok:     cookie 存在, 签名正确并且没有过期.
+func (c *Controller) GetSignedCookie(name string, maxAge int) (value string, ok bool) {
+	return c.Ctx.GetSignedCookie(name, maxAge)
+}
+
+// SetEncryptedCookie 设置 AES-GCM 加密的 cookie, 使用 [web] cookiekeys 中最新的 key 加密.
+// Parameters:
+// - name:   cookie 的名称.
+// - value:  cookie 的值.
+// - others: 同 Ctx.SetCookie, 可以为 context.CookieOptions.
+// Return:
+// - err:    没有配置 cookiekeys.
+func (c *Controller) SetEncryptedCookie(name, value string, others ...interface{}) (err error) {
+	return c.Ctx.SetEncryptedCookie(name, value, others...)
+}
+
+// GetEncryptedCookie 获取 SetEncryptedCookie 设置的 cookie, 使用旧的 key 加密的 cookie 仍然可以解密.
+// Parameters:
+// - name:  cookie 的名称.
+// Return:
+// - value: 解密之后的值.
+// - ok:    cookie 存在并且解密成功.
+func (c *Controller) GetEncryptedCookie(name string) (value string, ok bool) {
+	return c.Ctx.GetEncryptedCookie(name)
+}
+
 // XsrfToken 生成 xsrf token.
 func (c *Controller) XsrfToken() (token string) {
 	if c._xsrfToken == "" {
@@ -2,6 +2,7 @@ package fargo
 
 import (
 	"fmt"
+	"net/http"
 	"os"
 
 	"bdlib/comm"
@@ -24,6 +25,165 @@ func Add(pattern string, c ControllerInterface, mappingMethods ...string) (app *
 	return gApp
 }
 
+// Get 添加 GET 请求的函数路由到 Fargo 应用中.
+// Parameters:
+// - pattern: 注册的路由 URI, 如 /index, /admin/id 等.
+// - f:       处理函数.
+// Return:
+//  - app:    Fargo 对象.
+func Get(pattern string, f HandlerFunc) (app *App) {
+	gApp.Handlers.AddFunc("get", pattern, f)
+	return gApp
+}
+
+// Post 添加 POST 请求的函数路由到 Fargo 应用中.
+// Parameters:
+// - pattern: 注册的路由 URI, 如 /index, /admin/id 等.
+// - f:       处理函数.
+// Return:
+//  - app:    Fargo 对象.
+func Post(pattern string, f HandlerFunc) (app *App) {
+	gApp.Handlers.AddFunc("post", pattern, f)
+	return gApp
+}
+
+// Put 添加 PUT 请求的函数路由到 Fargo 应用中.
+// Parameters:
+// - pattern: 注册的路由 URI, 如 /index, /admin/id 等.
+// - f:       处理函数.
+// Return:
+//  - app:    Fargo 对象.
+func Put(pattern string, f HandlerFunc) (app *App) {
+	gApp.Handlers.AddFunc("put", pattern, f)
+	return gApp
+}
+
+// Delete 添加 DELETE 请求的函数路由到 Fargo 应用中.
+// Parameters:
+// - pattern: 注册的路由 URI, 如 /index, /admin/id 等.
+// - f:       处理函数.
+// Return:
+//  - app:    Fargo 对象.
+func Delete(pattern string, f HandlerFunc) (app *App) {
+	gApp.Handlers.AddFunc("delete", pattern, f)
+	return gApp
+}
+
+// Any 添加所有 http 方法的函数路由到 Fargo 应用中.
+// Parameters:
+// - pattern: 注册的路由 URI, 如 /index, /admin/id 等.
+// - f:       处理函数.
+// Return:
+//  - app:    Fargo 对象.
+func Any(pattern string, f HandlerFunc) (app *App) {
+	gApp.Handlers.AddFunc("*", pattern, f)
+	return gApp
+}
+
+// Handler 将 http.Handler 挂载到 Fargo 应用的 prefix 下, 如 Handler("/debug/pprof", http.HandlerFunc(pprof.Index), false).
+// Parameters:
+// - prefix:      挂载的 url 前缀.
+// - h:           http.Handler.
+// - stripPrefix: 是否在交给 h 之前去掉 url 中的 prefix.
+// Return:
+//  - app:        Fargo 对象.
+func Handler(prefix string, h http.Handler, stripPrefix bool) (app *App) {
+	gApp.Handlers.Handler(prefix, h, stripPrefix)
+	return gApp
+}
+
+// Use 添加中间件到 Fargo 应用中, 中间件包裹整个请求的分发过程, 先添加的中间件在外层.
+// Parameters:
+// - middlewares: 中间件.
+// Return:
+//  - app:        Fargo 对象.
+func Use(middlewares ...Middleware) (app *App) {
+	gApp.Handlers.Use(middlewares...)
+	return gApp
+}
+
+// AddVersion 添加指定 API 版本的路由到 Fargo 应用中, 如 AddVersion("v2", "/user/:id", &UserV2Controller{}).
+// Parameters:
+// - version:        API 版本, 如 v2.
+// - pattern:        注册的路由 URI.
+// - c:              controller 的接口对象.
+// - mappingMethods: 不定项的路由参数.
+// Return:
+//  - app:           Fargo 对象.
+func AddVersion(version, pattern string, c ControllerInterface, mappingMethods ...string) (app *App) {
+	gApp.Handlers.AddVersion(version, pattern, c, mappingMethods...)
+	return gApp
+}
+
+// SetDefaultVersion 设置 Fargo 应用默认的 API 版本, 请求中没有指定版本时使用.
+// Parameters:
+// - version: API 版本, 如 v1.
+func SetDefaultVersion(version string) {
+	gApp.Handlers.SetDefaultVersion(version)
+}
+
+// DeprecateVersion 将 Fargo 应用的 API 版本标记为废弃, 这些版本的请求会带上 Deprecation header.
+// Parameters:
+// - versions: 废弃的 API 版本.
+func DeprecateVersion(versions ...string) {
+	gApp.Handlers.DeprecateVersion(versions...)
+}
+
+// AddHost 添加绑定域名的路由到 Fargo 应用中, 如 AddHost(":tenant.example.com", "/", &TenantController{}).
+// Parameters:
+// - host:           绑定的域名.
+// - pattern:        注册的路由 URI, 如 /index, /admin/id 等.
+// - c:              controller 的接口对象.
+// - mappingMethods: 不定项的路由参数.
+// Return:
+//  - app:           Fargo 对象.
+func AddHost(host, pattern string, c ControllerInterface, mappingMethods ...string) (app *App) {
+	gApp.Handlers.AddHost(host, pattern, c, mappingMethods...)
+	return gApp
+}
+
+// AddAuto 添加智能路由到 Fargo 应用中, 如 UserController 的 List 方法对应 /user/list.
+// Parameters:
+// - c:    controller 的接口对象.
+// Return:
+//  - app: Fargo 对象.
+func AddAuto(c ControllerInterface) (app *App) {
+	gApp.AutoRouter(c)
+	return gApp
+}
+
+// AddNamed 添加命名路由到 Fargo 应用中, 之后可以通过 URLFor(name) 反向生成 url.
+// Parameters:
+// - name:           路由名称.
+// - pattern:        注册的路由 URI, 如 /index, /admin/id 等.
+// - c:              controller 的接口对象.
+// - mappingMethods: 不定项的路由参数.
+// Return:
+//  - app:           Fargo 对象.
+func AddNamed(name, pattern string, c ControllerInterface, mappingMethods ...string) (app *App) {
+	gApp.Handlers.AddNamed(name, pattern, c, mappingMethods...)
+	return gApp
+}
+
+// URLFor 通过路由名称或者 Controller.Method 反向生成 url, 例如 URLFor("UserController.Get", ":id", 12).
+// Parameters:
+// - endpoint: 路由名称或者 Controller.Method.
+// - values:   key, value 交替的参数.
+// Return:
+//  - u:       生成的 url.
+func URLFor(endpoint string, values ...interface{}) (u string) {
+	return gApp.Handlers.URLFor(endpoint, values...)
+}
+
+// NewNamespace 新建 Fargo 应用的路由分组.
+// Parameters:
+// - prefix: 分组的 url 前缀, 如 /api/v1.
+// Return:
+//  - ns:    路由分组.
+func NewNamespace(prefix string) (ns *Namespace) {
+	return gApp.Namespace(prefix)
+}
+
 // Run 开跑.
 func Run() {
 
@@ -164,3 +324,37 @@ func InsertFilter(pattern string, pos int, filter FilterFunc, params ...bool) *A
 	gApp.Handlers.InsertFilter(pattern, pos, filter, params...)
 	return gApp
 }
+
+// InsertNamedFilter 添加带名称和优先级的过滤函数到 Fargo 应用中, 优先级越小越先执行.
+// Parameters:
+// - name:     过滤函数名称, 为空时使用函数名.
+// - pattern:  过滤规则, 如 /admin/*.
+// - pos:      过滤函数执行的位置.
+// - priority: 优先级.
+// - filter:   过滤函数.
+// - params:   同 InsertFilter 的 returnOnOutput.
+// Return:
+//  - app:     Fargo 对象.
+func InsertNamedFilter(name, pattern string, pos, priority int, filter FilterFunc, params ...bool) (app *App) {
+	gApp.Handlers.InsertNamedFilter(name, pattern, pos, priority, filter, params...)
+	return gApp
+}
+
+// RemoveFilter 按名称删除 Fargo 应用中的过滤函数.
+// Parameters:
+// - name: 过滤函数名称.
+// Return:
+//  - ok:  是否删除了过滤函数.
+func RemoveFilter(name string) (ok bool) {
+	return gApp.Handlers.RemoveFilter(name)
+}
+
+// ReplaceFilter 按名称替换 Fargo 应用中的过滤函数, 如测试中替换掉鉴权的过滤函数.
+// Parameters:
+// - name:   过滤函数名称.
+// - filter: 新的过滤函数.
+// Return:
+//  - ok:    是否替换了过滤函数.
+func ReplaceFilter(name string, filter FilterFunc) (ok bool) {
+	return gApp.Handlers.ReplaceFilter(name, filter)
+}
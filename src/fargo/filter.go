@@ -7,18 +7,42 @@ import (
 // FilterFunc defines filter function type.
 type FilterFunc func(*context.Context)
 
+// HandlerFunc defines handler function type of function router.
+type HandlerFunc func(*context.Context)
+
+// Middleware wraps the whole dispatch of a request, it calls next to continue.
+type Middleware func(next HandlerFunc) HandlerFunc
+
 // FilterRouter defines filter operation before controller handler execution.
 // it can match patterned url and do filter function when action arrives.
 type FilterRouter struct {
+	name           string
+	priority       int
 	filterFunc     FilterFunc
 	tree           *Tree
 	pattern        string
 	returnOnOutput bool
+
+	// match 除了 url 之外的匹配条件, 如分组绑定的域名和 API 版本, 为 nil 时不限制.
+	// 和 filterFunc 分开保存, ReplaceFilter 替换过滤函数之后条件仍然有效.
+	match func(*context.Context) bool
+}
+
+// label 返回用于路由表的过滤函数名称, 匿名函数没有名称.
+func (f *FilterRouter) label() string {
+	if f.name == "" {
+		return "anonymous"
+	}
+	return f.name
 }
 
 // ValidRouter check current request is valid for this filter.
 // if matched, returns parsed params in this request by defined filter router pattern.
+// filters bound to a route have no tree and match every url of the route.
 func (f *FilterRouter) ValidRouter(router string) (bool, map[string]string) {
+	if f.tree == nil {
+		return true, nil
+	}
 	isok, params := f.tree.Match(router)
 	if isok == nil {
 		return false, nil
@@ -0,0 +1,125 @@
+package fargo
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+
+	fargocontext "fargo/context"
+)
+
+// errFlashNoBackend 没有开启 session 并且没有设置 cookie key, 无法保存 flash.
+var errFlashNoBackend = errors.New("flash is disabled: sessionOn is false and [web] cookiekeys is not set")
+
+// flashNoBackendOnce 第一次使用 flash 时记录 errFlashNoBackend, 之后只返回错误.
+var flashNoBackendOnce sync.Once
+
+// flashCookieMaxAge 保存 flash 的 cookie 的有效时间, 单位秒, flash 在跳转之后的请求中读取, 超时之后丢弃.
+const flashCookieMaxAge = 300
+
+// Flash 只在下一个请求中有效的一次性消息, 用于 post/redirect/get, 例如:
+//
+//	flash := fargo.NewFlash()
+//	flash.Notice("保存成功")
+//	flash.Store(&c.Controller)
+//	c.Redirect("/list", 302)
+//
+// 在跳转之后的请求中通过 fargo.ReadFromRequest(&c.Controller) 读取, 模板中通过 {{.flash.notice}} 获取.
+// 开启 session 时保存在 session 中, 没有开启时保存在以 [web] cookiekeys 签名的 cookie 中,
+// 两者都没有时无法保存 flash, Store 返回错误, 第一次使用时记录到日志中.
+type Flash struct {
+	// 消息, key: 消息类型, 如 notice, warning, error.
+	Data map[string]string
+}
+
+// NewFlash 新建一个空的 flash.
+// Return:
+// - flash: flash 对象.
+func NewFlash() (flash *Flash) {
+	return &Flash{Data: make(map[string]string)}
+}
+
+// Set 设置 key 对应的消息, msg 为格式化字符串.
+// Parameters:
+// - key:  消息类型, 如 success.
+// - msg:  消息.
+// - args: msg 的格式化参数.
+func (f *Flash) Set(key, msg string, args ...interface{}) {
+	if len(args) > 0 {
+		msg = fmt.Sprintf(msg, args...)
+	}
+	f.Data[key] = msg
+}
+
+// Notice 设置提示消息, 模板中通过 {{.flash.notice}} 获取.
+func (f *Flash) Notice(msg string, args ...interface{}) {
+	f.Set("notice", msg, args...)
+}
+
+// Warning 设置警告消息, 模板中通过 {{.flash.warning}} 获取.
+func (f *Flash) Warning(msg string, args ...interface{}) {
+	f.Set("warning", msg, args...)
+}
+
+// Error 设置错误消息, 模板中通过 {{.flash.error}} 获取.
+func (f *Flash) Error(msg string, args ...interface{}) {
+	f.Set("error", msg, args...)
+}
+
+// Store 保存 flash, 在下一个请求中通过 ReadFromRequest 读取, 同时设置到当前请求的 c.Data["flash"] 中.
+// Parameters:
+// - c:   当前请求的 controller.
+// Return:
+// - err: 保存到 session 失败, 或者没有开启 session 并且没有设置 cookie key.
+func (f *Flash) Store(c *Controller) (err error) {
+	c.Data["flash"] = f.Data
+	values := url.Values{}
+	for k, v := range f.Data {
+		values.Set(k, v)
+	}
+
+	if c.StartSession() != nil {
+		if err = c.SetSession(FlashName, values.Encode()); err != nil {
+			Error(err)
+		}
+		return
+	}
+	if !fargocontext.HasCookieKeys() {
+		flashNoBackendOnce.Do(func() { Error(errFlashNoBackend) })
+		return errFlashNoBackend
+	}
+
+	return c.SetSignedCookie(FlashName, values.Encode(),
+		fargocontext.CookieOptions{MaxAge: flashCookieMaxAge, Path: "/", HttpOnly: true, SameSite: http.SameSiteLaxMode})
+}
+
+// ReadFromRequest 读取上一个请求保存的 flash 并设置到 c.Data["flash"] 中, 读取之后 flash 被删除.
+// Parameters:
+// - c:     当前请求的 controller.
+// Return:
+// - flash: flash 对象, 没有 flash 或者 cookie 签名错误时为空的 flash.
+func ReadFromRequest(c *Controller) (flash *Flash) {
+	flash = NewFlash()
+
+	var encoded string
+	if c.StartSession() != nil {
+		if v, ok := c.GetSession(FlashName).(string); ok {
+			encoded = v
+			c.DelSession(FlashName)
+		}
+	} else if c.Ctx.GetCookie(FlashName) != "" {
+		encoded, _ = c.GetSignedCookie(FlashName, flashCookieMaxAge)
+		c.Ctx.SetCookie(FlashName, "", -1, "/")
+	}
+
+	if values, err := url.ParseQuery(encoded); err == nil {
+		for k := range values {
+			flash.Data[k] = values.Get(k)
+		}
+	}
+	c.Data["flash"] = flash.Data
+
+	return
+}
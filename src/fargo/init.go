@@ -5,6 +5,7 @@ import (
 	"bdlib/config"
 	"bdlib/logger"
 	"bdlib/util"
+	fargocontext "fargo/context"
 	"fargo/session"
 	"flag"
 	"fmt"
@@ -62,7 +63,6 @@ func init() {
 	Log = logger.NewLogger("fargo")
 	logger.DefaultLog = Log
 	go Log.WatchErrors(gPrefix, gPath)
-	defer Log.Close()
 
 	// 框架执行者
 	gApp = NewApp()
@@ -111,6 +111,10 @@ func initFargo() (err error) {
 
 	sessionOn, _ = gCfg.GetBoolSetting(webSection, "sessionOn", false)
 
+	// 默认的 API 版本以及废弃的 API 版本, 如 v1, "v0,v1".
+	apiVersion, _ = gCfg.GetSetting(webSection, "apiversion")
+	deprecatedVersions, _ = gCfg.GetSetting(webSection, "deprecatedversions")
+
 	// // 是否加载框架模板函数, 默认为 true
 	// gEnableTemplateFunc, _ = gCfg.GetBoolSetting(webSection, "enableTemplteFunc", true)
 	// if gEnableTemplateFunc {
@@ -141,6 +145,9 @@ func initFargo() (err error) {
 	// 是否开启 access log.
 	enableAccessLog, _ = gCfg.GetBoolSetting(webSection, "enablegaccesslog", true)
 
+	// 是否开启严格路由模式, 存在冲突或者非法的路由时启动失败, 默认为 false.
+	strictRouter, _ = gCfg.GetBoolSetting(webSection, "strictrouter", false)
+
 	// 是否开启 display directory
 	directoryIndex, _ = gCfg.GetBoolSetting(webSection, "directIndex", false)
 
@@ -157,6 +164,11 @@ func initFargo() (err error) {
 	}
 	XSRFExpire, _ = gCfg.GetIntSetting(webSection, "xsrfExpire", 0)
 
+	// flash 消息的名称.
+	if name, _ := gCfg.GetSetting(webSection, "flashname"); name != "" {
+		FlashName = name
+	}
+
 	// 模板文件路径
 	tplPrefix, _ = gCfg.GetSetting(webSection, "tplPrefix")
 	templateDirc = tplPrefix
@@ -174,6 +186,21 @@ func initFargo() (err error) {
 	// server 超时时间
 	gHTTPServerTimeOut, _ = gCfg.GetIntSetting(webSection, "servertimeout", 60)
 
+	// 请求的 context.Context 超时时间, 单位毫秒.
+	requestTimeout, _ = gCfg.GetIntSetting(webSection, "requesttimeout", 0)
+
+	// 签名以及加密 cookie 的 key, 逗号分隔, 最新的 key 在前面, 旧的 key 只用于验证和解密.
+	if keys, _ := gCfg.GetSetting(webSection, "cookiekeys"); keys != "" {
+		fargocontext.SetCookieKeys(strings.Split(keys, ","))
+	}
+
+	// 受信任的代理, 逗号分隔的网段或者 ip, 只有来自这些地址的请求才使用 X-Forwarded-* 以及 Forwarded header.
+	if proxies, _ := gCfg.GetSetting(webSection, "trustedproxies"); proxies != "" {
+		if err = fargocontext.SetTrustedProxies(strings.Split(proxies, ",")); err != nil {
+			fmt.Println(comm.WrapError(err))
+		}
+	}
+
 	// post 最大内存
 	maxMemory, _ = gCfg.GetIntSetting(webSection, "maxMemory", 1<<26)
 
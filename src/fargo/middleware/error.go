@@ -255,7 +255,7 @@ func Exception(errcode string, w http.ResponseWriter, r *http.Request, msg strin
 	if err != nil {
 		isint = 500
 	}
-	if 400 == isint {
+	if 404 == isint && msg == "" {
 		msg = "404 page not found"
 	}
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
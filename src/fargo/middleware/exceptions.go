@@ -4,12 +4,12 @@ import (
 	"fmt"
 )
 
-// HTTPException http exceptions
+// HTTPException http exceptions, 也用于 Context.Abort 以及 StopRun 中止请求.
 type HTTPException struct {
-	// http 状态信息 如 4xx, 5xx
+	// http 状态信息 如 4xx, 5xx, 为 0 时只中止请求, 不输出任何内容.
 	StatusCode int
 
-	// 描述信息
+	// 描述信息, Abort 时作为输出的 body.
 	Description string
 }
 
@@ -0,0 +1,229 @@
+package fargo
+
+import (
+	"fargo/context"
+	"strings"
+)
+
+// Namespace 路由分组, 组内添加的路由共享同一个 url 前缀和过滤函数, 分组可以嵌套,
+// 使用方法为:
+//
+//	ns := fargo.NewNamespace("/api/v1").Filter(fargo.BEFORE_ROUTER, auth)
+//	ns.Add("/user/:id:int", &UserController{}).Timeout(time.Second)
+//	ns.Namespace("/admin").Filter(fargo.BEFORE_EXEC, checkAdmin).Add("/index", &AdminController{})
+//
+// 则 /api/v1/user/:id:int 经过 auth 过滤, /api/v1/admin/index 先后经过 auth 和 checkAdmin 过滤.
+// 分组的 Add, AddNamed 以及 AddFunc 返回添加的路由, 可以继续绑定路由的过滤函数和超时时间.
+type Namespace struct {
+	// url 前缀, 以 / 开头并且不以 / 结尾, 根分组为空.
+	prefix string
+
+	// 绑定的 API 版本, 为空时不限制版本.
+	version string
+
+	// 没有版本前缀的 url 前缀, 通过 header 指定版本的请求使用, 没有绑定版本时同 prefix.
+	basePrefix string
+
+	// 绑定的域名, 为空时不限制域名.
+	host string
+
+	// 域名路由树, 用于过滤函数匹配域名.
+	hostTree *Tree
+
+	// 路由集合.
+	handlers *ControllerRegistor
+
+	// 分组以及父分组添加的过滤函数, Version 时重新注册到带版本的前缀上.
+	filters []namespaceFilter
+}
+
+// namespaceFilter 分组添加的过滤函数.
+type namespaceFilter struct {
+	pos    int
+	filter FilterFunc
+	params []bool
+}
+
+// Namespace 新建一个路由分组.
+// Parameters:
+// - prefix: 分组的 url 前缀, 如 /api/v1.
+// Return:
+// - ns:     路由分组.
+func (p *ControllerRegistor) Namespace(prefix string) (ns *Namespace) {
+	prefix = strings.TrimRight(joinPattern("", prefix), "/")
+	return &Namespace{
+		prefix:     prefix,
+		basePrefix: prefix,
+		handlers:   p,
+	}
+}
+
+// Namespace 在分组下新建一个子分组, 子分组的前缀为两者拼接, 并且继承父分组的过滤函数.
+// Parameters:
+// - prefix: 子分组的 url 前缀, 如 /admin.
+// Return:
+// - ns:     子分组.
+func (n *Namespace) Namespace(prefix string) (ns *Namespace) {
+	return &Namespace{
+		prefix:     strings.TrimRight(joinPattern(n.prefix, prefix), "/"),
+		version:    n.version,
+		basePrefix: strings.TrimRight(joinPattern(n.basePrefix, prefix), "/"),
+		host:       n.host,
+		hostTree:   n.hostTree,
+		handlers:   n.handlers,
+		filters:    append([]namespaceFilter(nil), n.filters...),
+	}
+}
+
+// Host 将分组绑定到域名上, 之后添加的路由、过滤函数和子分组只对此域名生效,
+// host 中可以使用参数, 如 :tenant.example.com, 通过 Input.Param(":tenant") 获取.
+// Parameters:
+// - host: 绑定的域名, 如 admin.example.com, :tenant.example.com.
+// Return:
+// - ns:   分组本身, 便于链式调用.
+func (n *Namespace) Host(host string) (ns *Namespace) {
+	n.host = strings.ToLower(host)
+	n.hostTree = NewTree()
+	n.hostTree.AddRouter(hostPath(n.host), true)
+	return n
+}
+
+// Version 新建一个绑定到 API 版本上的子分组, 用法同 ControllerRegistor.AddVersion.
+// 和 AddVersion 一样版本在最前面, 前缀为 /<version> 加上分组的前缀, 而不是分组的前缀加上 /<version>,
+// 例如 NewNamespace("/api").Version("v2").Add("/user", &UserV2Controller{}) 注册 /v2/api/user,
+// 可以通过 /v2/api/user 或者带有版本 header 的 /api/user 访问.
+// 分组本身不变, 分组以及父分组已经添加的过滤函数同时作用于带版本的前缀.
+// 子分组的过滤函数只在请求的版本, 即 Input.Version(), 为 version 时执行, 包括通过 header 或者默认版本指定版本的请求.
+// Parameters:
+// - version: API 版本, 如 v2.
+// Return:
+// - ns:      带版本的子分组.
+func (n *Namespace) Version(version string) (ns *Namespace) {
+	version = normalizeVersion(version)
+	n.handlers.versions[version] = true
+
+	ns = n.Namespace("")
+	ns.version = version
+	ns.prefix = strings.TrimRight(joinPattern("/"+version, n.basePrefix), "/")
+	// 已有的过滤函数已经作用于没有版本前缀的 url, 只需要加到带版本的前缀上.
+	for _, f := range ns.filters {
+		ns.insertFilter(ns.prefix, f.pos, f.filter, f.params...)
+	}
+	return
+}
+
+// Prefix 返回分组的 url 前缀.
+func (n *Namespace) Prefix() (prefix string) {
+	return n.prefix
+}
+
+// Add 添加路由到分组中, 路由的 URI 为分组前缀和 pattern 的拼接, 用法同 ControllerRegistor.Add.
+// Parameters:
+// - pattern:        注册的路由 URI, 如 /index, /admin/id 等.
+// - c:              controller 的接口对象.
+// - mappingMethods: 不定项的路由参数, 用于自定义路由方法时候, 如 “post:postRouter;get:getIndex”.
+// Return:
+// - route:          添加的路由, 可以通过 route.Filter 和 route.Timeout 绑定只作用于此路由的过滤函数和超时时间.
+func (n *Namespace) Add(pattern string, c ControllerInterface, mappingMethods ...string) (route *Route) {
+	return &Route{info: n.handlers.addRoute(n.host, "", joinPattern(n.prefix, pattern), c, mappingMethods...)}
+}
+
+// AddNamed 添加命名路由到分组中, 用法同 ControllerRegistor.AddNamed.
+// Parameters:
+// - name:           路由名称.
+// - pattern:        注册的路由 URI, 如 /index, /admin/id 等.
+// - c:              controller 的接口对象.
+// - mappingMethods: 不定项的路由参数.
+// Return:
+// - route:          添加的路由.
+func (n *Namespace) AddNamed(name, pattern string, c ControllerInterface, mappingMethods ...string) (route *Route) {
+	return &Route{info: n.handlers.addRoute(n.host, name, joinPattern(n.prefix, pattern), c, mappingMethods...)}
+}
+
+// AddFunc 添加函数路由到分组中, 用法同 ControllerRegistor.AddFunc.
+// Parameters:
+// - methods: 逗号分隔的 http 方法, 如 get, "get,post", "*" 表示所有方法.
+// - pattern: 注册的路由 URI, 如 /index, /admin/id 等.
+// - f:       处理函数.
+// Return:
+// - route:   添加的路由.
+func (n *Namespace) AddFunc(methods, pattern string, f HandlerFunc) (route *Route) {
+	return &Route{info: n.handlers.addFuncRoute(n.host, methods, joinPattern(n.prefix, pattern), f)}
+}
+
+// Filter 为分组添加过滤函数, 过滤函数作用于分组前缀下的所有 url, 包括子分组,
+// pos 一般为 BEFORE_ROUTER, BEFORE_EXEC 和 AFTER_EXEC.
+// Parameters:
+// - pos:    过滤函数执行的位置.
+// - filter: 过滤函数.
+// - params: 同 InsertFilter 的 returnOnOutput.
+// Return:
+// - ns:     分组本身, 便于链式调用.
+func (n *Namespace) Filter(pos int, filter FilterFunc, params ...bool) (ns *Namespace) {
+	n.filters = append(n.filters, namespaceFilter{pos: pos, filter: filter, params: params})
+	n.insertFilter(n.prefix, pos, filter, params...)
+	// 通过 header 或者默认版本指定版本的请求没有版本前缀.
+	if n.version != "" {
+		n.insertFilter(n.basePrefix, pos, filter, params...)
+	}
+	return n
+}
+
+// insertFilter 将过滤函数注册到 prefix 上, 分组绑定了域名或者版本时只对此域名和版本的请求执行.
+func (n *Namespace) insertFilter(prefix string, pos int, filter FilterFunc, params ...bool) {
+	if !RouterCaseSensitive {
+		prefix = strings.ToLower(prefix)
+	}
+
+	mr := new(FilterRouter)
+	mr.tree = NewTree()
+	mr.pattern = prefix + "/*"
+	mr.filterFunc = filter
+	mr.name = filterName(filter)
+	if n.hostTree != nil || n.version != "" {
+		hostTree, version := n.hostTree, n.version
+		mr.match = func(ctx *context.Context) bool {
+			if version != "" && ctx.Input.Version() != version {
+				return false
+			}
+			if hostTree != nil {
+				if ok, _ := hostTree.Match(hostPath(strings.ToLower(ctx.Input.Host()))); ok == nil {
+					return false
+				}
+			}
+			return true
+		}
+	}
+	if len(params) == 0 {
+		mr.returnOnOutput = true
+	} else {
+		mr.returnOnOutput = params[0]
+	}
+	// 前缀本身以及前缀下的所有 url.
+	if prefix == "" {
+		mr.tree.AddRouter("/", true)
+	} else {
+		mr.tree.AddRouter(prefix, true)
+	}
+	mr.tree.AddRouter(prefix+"/*", true)
+	n.handlers.insertFilterRouter(pos, mr)
+}
+
+// joinPattern 拼接分组前缀和路由 URI.
+// "" + "/" -> "/"
+// "/api" + "/" -> "/api"
+// "/api/" + "user" -> "/api/user"
+func joinPattern(prefix, pattern string) string {
+	prefix = strings.TrimRight(prefix, "/")
+	if pattern == "" || pattern == "/" {
+		if prefix == "" {
+			return "/"
+		}
+		return prefix
+	}
+	if !strings.HasPrefix(pattern, "/") {
+		pattern = "/" + pattern
+	}
+
+	return prefix + pattern
+}
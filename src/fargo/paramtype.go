@@ -0,0 +1,153 @@
+package fargo
+
+import (
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParamConverter 将路由参数转换成对应类型的值, 返回错误时请求返回 400.
+type ParamConverter func(value string) (interface{}, error)
+
+// paramType 路由参数类型, 如 :id:int 中的 int.
+type paramType struct {
+	// 匹配参数的正则, 不含捕获分组.
+	regexp string
+
+	// 参数转换函数, 为 nil 时不转换.
+	convert ParamConverter
+}
+
+// paramTypes 注册的路由参数类型, key: 类型名称.
+var paramTypes = map[string]*paramType{
+	"int": {regexp: `[0-9]+`, convert: func(v string) (interface{}, error) {
+		return strconv.Atoi(v)
+	}},
+	"string": {regexp: `[\w]+`},
+	"int64": {regexp: `-?[0-9]+`, convert: func(v string) (interface{}, error) {
+		return strconv.ParseInt(v, 10, 64)
+	}},
+	"uuid": {regexp: `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`, convert: func(v string) (interface{}, error) {
+		return strings.ToLower(v), nil
+	}},
+	"date": {regexp: `[0-9]{4}-[0-9]{2}-[0-9]{2}`, convert: func(v string) (interface{}, error) {
+		return time.Parse("2006-01-02", v)
+	}},
+	"slug": {regexp: `[a-z0-9]+(?:-[a-z0-9]+)*`},
+	"hex": {regexp: `[0-9a-fA-F]+`, convert: func(v string) (interface{}, error) {
+		return hex.DecodeString(v)
+	}},
+}
+
+// AddParamType 注册路由参数类型, 之后可以在路由中使用 :name:type, 如
+// AddParamType("upper", "[A-Z]+", nil) 之后 Add("/code/:code:upper", &CodeController{}).
+// 转换之后的值通过 Input.ParamValue 获取, 字符串值仍然通过 Input.Param 获取.
+// 内置的类型有 int(int), string, int64(int64), uuid(小写的 string), date(time.Time), slug, hex([]byte).
+// 需要在添加路由之前注册, 同名的类型会被覆盖. RouterCaseSensitive 为 false 时路由会被转换为小写, 此时类型名称需要为小写.
+// 路由中使用没有注册的类型, 如 :id:integer, 会被作为非法的路由记录到 RouteErrors 中.
+// Parameters:
+// - name:    类型名称, 只能包含字母, 数字和下划线.
+// - expr:    匹配参数的正则, 不能包含捕获分组, 分组请使用 (?:...).
+// - convert: 参数转换函数, 为 nil 时不转换.
+// Return:
+// - err:     类型名称或者正则非法.
+func AddParamType(name, expr string, convert ParamConverter) (err error) {
+	if name == "" || strings.TrimLeft(name, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_") != "" {
+		return fmt.Errorf("invalid param type name %s", name)
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return fmt.Errorf("invalid param type %s: %v", name, err)
+	}
+	if re.NumSubexp() > 0 {
+		return fmt.Errorf("invalid param type %s: regexp %s has capturing groups", name, expr)
+	}
+	paramTypes[name] = &paramType{regexp: expr, convert: convert}
+
+	return nil
+}
+
+// paramTypeName 返回 s 开头的类型名称, 即第一个字母, 数字和下划线以外的字符之前的部分.
+func paramTypeName(s string) string {
+	end := 0
+	for end < len(s) && (s[end] == '_' || s[end] >= 'a' && s[end] <= 'z' ||
+		s[end] >= 'A' && s[end] <= 'Z' || s[end] >= '0' && s[end] <= '9') {
+		end++
+	}
+	return s[:end]
+}
+
+// lookupParamType 查找 s 开头的参数类型, 整个类型名称必须是注册的类型, 如 :id:integer 不会匹配 int.
+// Parameters:
+// - s: 参数名称之后 ":" 之后的部分, 如 :id:int64 中的 int64.
+// Return:
+// - name: 类型名称, 即 s 开头的字母, 数字和下划线, 可能为空.
+// - pt:   参数类型, 类型没有注册时为 nil.
+func lookupParamType(s string) (name string, pt *paramType) {
+	name = paramTypeName(s)
+	return name, paramTypes[name]
+}
+
+// typedParams 返回路由 URI 中带类型的参数, 跳过正则 (...) 中的内容.
+// Parameters:
+// - pattern: 路由 URI 或者其中的一段, 如 /user/:id:int64.
+// Return:
+// - params:  参数名称和类型名称, 如 {":id", "int64"}, 类型可能没有注册.
+func typedParams(pattern string) (params [][2]string) {
+	depth := 0
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '(':
+			depth++
+			continue
+		case ')':
+			depth--
+			continue
+		case ':':
+		default:
+			continue
+		}
+		if depth > 0 {
+			continue
+		}
+		j := i + 1 + len(paramTypeName(pattern[i+1:]))
+		if j == i+1 || j >= len(pattern) || pattern[j] != ':' {
+			continue
+		}
+		name := paramTypeName(pattern[j+1:])
+		if name == "" {
+			continue
+		}
+		params = append(params, [2]string{pattern[i:j], name})
+		i = j + len(name)
+	}
+
+	return
+}
+
+// routeConverters 返回路由 URI 中带类型的参数的转换函数.
+// Parameters:
+// - pattern: 路由 URI, 如 /user/:id:int64.
+// Return:
+// - converters: key: 参数名称, 如 :id, RouterCaseSensitive 为 false 时和路由树中的参数一样为小写.
+func routeConverters(pattern string) (converters map[string]ParamConverter) {
+	for _, param := range typedParams(pattern) {
+		pt := paramTypes[param[1]]
+		if pt == nil || pt.convert == nil {
+			continue
+		}
+		if converters == nil {
+			converters = make(map[string]ParamConverter)
+		}
+		key := param[0]
+		if !RouterCaseSensitive {
+			key = strings.ToLower(key)
+		}
+		converters[key] = pt.convert
+	}
+
+	return
+}
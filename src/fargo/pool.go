@@ -0,0 +1,167 @@
+package fargo
+
+import (
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	fargocontext "fargo/context"
+)
+
+// disablePool 为 true 时每个请求都新建 Context, responseWriter 以及 controller, 请求结束之后不放回 pool,
+// 用于对比复用的效果, 见 BenchmarkServeHTTP.
+var disablePool bool
+
+// contextPool 复用每个请求的 Context 以及对应的 FargoInput 和 FargoOutput.
+var contextPool = sync.Pool{
+	New: func() interface{} {
+		context := &fargocontext.Context{
+			Input:  fargocontext.NewInput(nil),
+			Output: fargocontext.NewOutput(),
+		}
+		context.Output.Context = context
+		return context
+	},
+}
+
+// writerPool 复用每个请求的 responseWriter.
+var writerPool = sync.Pool{
+	New: func() interface{} {
+		return new(responseWriter)
+	},
+}
+
+// handlerControllerPool 复用函数路由使用的 Controller.
+var handlerControllerPool = sync.Pool{
+	New: func() interface{} {
+		return new(Controller)
+	},
+}
+
+// controllerPools 每个 controller 类型对应的 *sync.Pool, key: reflect.Type.
+var controllerPools sync.Map
+
+// acquireContext 从 pool 中获取 Context 和 responseWriter 并且重置为新的请求.
+// Parameters:
+// - rw:      http 输出.
+// - r:       http 请求.
+// Return:
+// - context: 上下文, ResponseWriter 为 w.
+// - w:       封装之后的 http 输出.
+func acquireContext(rw http.ResponseWriter, r *http.Request) (context *fargocontext.Context, w *responseWriter) {
+	if disablePool {
+		w = writerPool.New().(*responseWriter)
+		context = contextPool.New().(*fargocontext.Context)
+	} else {
+		w = writerPool.Get().(*responseWriter)
+		context = contextPool.Get().(*fargocontext.Context)
+	}
+	*w = responseWriter{writer: rw, start: time.Now()}
+	context.Reset(w, r)
+	return
+}
+
+// releaseContext 请求结束之后将 Context 和 responseWriter 放回 pool,
+// 被 Retain 标记或者连接被 hijack 时不放回, 避免之后仍在使用的引用读到其他请求的数据.
+// Parameters:
+// - context: 上下文.
+// - w:       封装之后的 http 输出.
+func releaseContext(context *fargocontext.Context, w *responseWriter) {
+	if disablePool || context.Retained() || w.hijacked {
+		return
+	}
+	// 中间件替换 ResponseWriter 之后 dispatch 重新封装的 responseWriter.
+	if cw, ok := context.ResponseWriter.(*responseWriter); ok && cw.hijacked {
+		return
+	}
+	*w = responseWriter{}
+	writerPool.Put(w)
+
+	context.Reset(nil, nil)
+	contextPool.Put(context)
+}
+
+// acquireController 从 pool 中获取 controller, 获取到的 controller 除了 Data 和 LayoutSections 为空的 map 之外,
+// 和 reflect.New 新建的一样为零值.
+// Parameters:
+// - t: controller 的类型.
+// Return:
+// - c: 指向 controller 的反射值.
+func acquireController(t reflect.Type) (c reflect.Value) {
+	if disablePool {
+		return reflect.New(t)
+	}
+	pool, ok := controllerPools.Load(t)
+	if !ok {
+		pool, _ = controllerPools.LoadOrStore(t, &sync.Pool{
+			New: func() interface{} {
+				return reflect.New(t).Interface()
+			},
+		})
+	}
+	return reflect.ValueOf(pool.(*sync.Pool).Get())
+}
+
+// releaseController 清空 controller 并放回 pool, Context 被 Retain 标记时不放回.
+// Parameters:
+// - context: 上下文.
+// - c:       指向 controller 的反射值.
+func releaseController(context *fargocontext.Context, c reflect.Value) {
+	if disablePool || context.Retained() {
+		return
+	}
+	var data map[interface{}]interface{}
+	var sections map[string]string
+	b, ok := c.Interface().(interface{ base() *Controller })
+	if ok {
+		data, sections = b.base().Data, b.base().LayoutSections
+	}
+	t := c.Type().Elem()
+	c.Elem().Set(reflect.Zero(t))
+	if ok {
+		b.base().Data, b.base().LayoutSections = clearData(data), clearSections(sections)
+	}
+	if pool, ok := controllerPools.Load(t); ok {
+		pool.(*sync.Pool).Put(c.Interface())
+	}
+}
+
+// acquireHandlerController 从 pool 中获取函数路由使用的 Controller.
+// Return:
+// - c: 零值的 Controller.
+func acquireHandlerController() (c *Controller) {
+	if disablePool {
+		return new(Controller)
+	}
+	return handlerControllerPool.Get().(*Controller)
+}
+
+// releaseHandlerController 清空函数路由使用的 Controller 并放回 pool, Context 被 Retain 标记时不放回.
+// Parameters:
+// - context: 上下文.
+// - c:       函数路由使用的 Controller.
+func releaseHandlerController(context *fargocontext.Context, c *Controller) {
+	if disablePool || context.Retained() {
+		return
+	}
+	data, sections := c.Data, c.LayoutSections
+	*c = Controller{Data: clearData(data), LayoutSections: clearSections(sections)}
+	handlerControllerPool.Put(c)
+}
+
+// clearData 清空 Controller.Data 以便复用.
+func clearData(data map[interface{}]interface{}) map[interface{}]interface{} {
+	for k := range data {
+		delete(data, k)
+	}
+	return data
+}
+
+// clearSections 清空 Controller.LayoutSections 以便复用.
+func clearSections(sections map[string]string) map[string]string {
+	for k := range sections {
+		delete(sections, k)
+	}
+	return sections
+}
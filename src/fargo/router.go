@@ -4,15 +4,19 @@ import (
 	"bdlib/comm"
 	"bdlib/util"
 	"bufio"
+	"bytes"
+	stdcontext "context"
 	fargocontext "fargo/context"
 	"fargo/middleware"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"reflect"
-	"regexp"
+	"runtime"
 	"strconv"
 	"strings"
 	"time"
@@ -36,10 +40,13 @@ var (
 	HTTPMETHOD = []string{"get", "post", "put", "delete", "patch", "options", "head"}
 
 	// exceptMethod fargo.Controller 支持的方法 但是不会反射到 AutoRouter 上.
-	exceptMethod = []string{"Init", "Prepare", "Finish", "Render", "RenderString",
-		"RenderBytes", "Redirect", "Input", "ParseForm", "GetString", "GetStrings", "GetInt", "GetBool",
+	exceptMethod = []string{"Init", "Prepare", "Finish", "StopRun", "Abort", "Render", "RenderString",
+		"RenderBytes", "Redirect", "Input", "Bind", "ParseForm", "Validate", "Serve", "GetString", "GetStrings", "GetInt", "GetBool",
 		"GetFloat", "GetFile", "SaveToFile", "StartSession", "SetSession", "GetSession",
-		"DelSession", "SessionRegenerate", "DestroySession", "IsAjax", "XsrfToken", "CheckXSRFCookie"}
+		"DelSession", "SessionRegenerate", "DestroySession", "IsAjax", "XsrfToken", "CheckXSRFCookie", "URLFor",
+		"Filter", "GetStringms", "GetStringm", "GetSecureCookie", "SetSecureCookie",
+		"GetSignedCookie", "SetSignedCookie", "GetEncryptedCookie", "SetEncryptedCookie", "XsrfFormHTML",
+		"GetConfiger", "GetCfgSection", "GetCfgSetting", "GetCfgIntSetting", "GetCfgBoolSetting"}
 )
 
 // controllerInfo 每一个 controller router 的信息集合.
@@ -47,30 +54,59 @@ type controllerInfo struct {
 	// 注册的 URI.
 	pattern string
 
-	// 注册的正则路由的编译对象.
-	regex *regexp.Regexp
+	// 绑定的域名, 如 admin.example.com, :tenant.example.com, 为空时不限制域名.
+	host string
 
-	// 参数集.
-	params map[int]string
-
-	// controller 对应的类型, 通过反射获得.
+	// controller 对应的类型, 通过反射获得, 函数路由为 nil.
 	controllerType reflect.Type
 
+	// 函数路由的处理函数, 不为 nil 时不会通过反射创建 controller.
+	handler HandlerFunc
+
+	// 挂载的 http.Handler, 不为 nil 时请求直接交给它处理.
+	httpHandler http.Handler
+
 	// controller 对应的方法集合.
 	methods map[string]string
 
 	// 判断 controller 是否含有方法.
 	hasMethod bool
+
+	// 自定义方法的参数名称, key: 方法名称.
+	actionParams map[string][]string
+
+	// controller 重写了的 http 方法, key: 小写的 http 方法, 如 get, post 等.
+	overridden map[string]bool
+
+	// 路由 URI 的每一段以及在路由树中的优先级, 用于检测路由冲突.
+	segments []routeSegment
+	priority int
+
+	// 是否为智能路由, 智能路由不在路由树中.
+	auto bool
+
+	// 带类型的参数的转换函数, key: 参数名称, 如 :id.
+	converters map[string]ParamConverter
+
+	// 绑定到路由上的过滤函数, key: 过滤函数执行的位置, 只支持 BEFORE_EXEC 和 AFTER_EXEC.
+	filters map[int][]*FilterRouter
+
+	// 请求的 context.Context 的超时时间, 为 0 时使用全局的 requesttimeout.
+	timeout time.Duration
 }
 
-// ControllerRegistor controller router 注册, 包含路由规则(正则 + 固定路由), 以及 controller handler,
+// ControllerRegistor controller router 注册, 包含路由规则(路由树), 以及 controller handler,
 // 在添加路由的时候就将路由信息加入到了这里.
 type ControllerRegistor struct {
-	// 正则路由
-	routers []*controllerInfo
+	// 路由树, key: http 方法, 如 get, post 等.
+	routers map[string]*Tree
+
+	// 域名路由树, 域名按 "." 反转之后作为路径, 如 :tenant.example.com 为 /com/example/:tenant,
+	// runObject 为 *hostRouter.
+	hostTree *Tree
 
-	// 固定路由
-	fixrouters []*controllerInfo
+	// 域名路由, key: 注册的域名.
+	hostRouters map[string]*hostRouter
 
 	// 是否开启过滤
 	enableFilter bool
@@ -83,15 +119,58 @@ type ControllerRegistor struct {
 
 	// 智能路由 key: controller key: method value: reflect.type
 	autoRouter map[string]map[string]reflect.Type
+
+	// 命名路由, key: 路由名称或者 Controller.Method, 用于 URLFor 反向生成 url.
+	namedRouters map[string]*controllerInfo
+
+	// 按照注册顺序排列的所有路由.
+	routes []*controllerInfo
+
+	// 注册路由时的错误.
+	errs []error
+
+	// 通过 Use 添加的中间件.
+	middlewares []Middleware
+
+	// 中间件包裹之后的请求分发函数.
+	handler HandlerFunc
+
+	// 注册过的 API 版本, 用于识别 url 中的版本前缀.
+	versions map[string]bool
+
+	// 默认的 API 版本.
+	defaultVersion string
+
+	// 废弃的 API 版本.
+	deprecatedVersions map[string]bool
+}
+
+// hostRouter 绑定到某一个域名上的路由集合.
+type hostRouter struct {
+	// 注册的域名.
+	host string
+
+	// 路由树, key: http 方法, 如 get, post 等.
+	routers map[string]*Tree
 }
 
 // NewControllerRegistor 初始化新建一个路由集合.
 func NewControllerRegistor() (ct *ControllerRegistor) {
-	return &ControllerRegistor{
-		routers:    make([]*controllerInfo, 0),
-		autoRouter: make(map[string]map[string]reflect.Type),
-		filters:    make(map[int][]*FilterRouter),
+	ct = &ControllerRegistor{
+		routers:            make(map[string]*Tree),
+		hostTree:           NewTree(),
+		hostRouters:        make(map[string]*hostRouter),
+		autoRouter:         make(map[string]map[string]reflect.Type),
+		filters:            make(map[int][]*FilterRouter),
+		namedRouters:       make(map[string]*controllerInfo),
+		versions:           make(map[string]bool),
+		deprecatedVersions: make(map[string]bool),
 	}
+	ct.handler = ct.dispatch
+	ct.SetDefaultVersion(apiVersion)
+	ct.DeprecateVersion(strings.Split(deprecatedVersions, ",")...)
+
+	return ct
 }
 
 // Add 添加路由的 handler 和 URI 到路由集合对象中,
@@ -102,135 +181,598 @@ func NewControllerRegistor() (ct *ControllerRegistor) {
 // - PUT 请求到指定方法: Add("/api/update", &RestController{}, "put:UpdateFood"),
 // - DELETE 请求到指定方法: Add("/api/delete", &RestController{}, "delete:DeleteFood"),
 // - 同时多个请求到指定方法: Add("/api", &RestController{}, "get,post:ApiFunc"),
-// - 同时指定多种不同对应关系: Add("/admin", &AdminController{}, "get:GetFunc;post:PostFunc").
+// - 同时指定多种不同对应关系: Add("/admin", &AdminController{}, "get:GetFunc;post:PostFunc"),
+// - 方法带有参数: Add("/food/:id", &FoodController{}, "get:List(id,page,q)"), 对应的方法如
+// func (c *FoodController) List(id int64, page int, q string) (interface{}, error),
+// 参数按照名称从路由参数, url 参数以及表单中获取, 返回值通过 Serve 输出, error 输出为 {"error": "..."}.
+// 路由匹配时固定路由优先, 其次是带类型的参数路由(:id:int, :name:string), 再次是普通参数路由, 最后是全匹配路由(*, *.*).
 // Parameters:
 // - pattern:        注册的路由 URI, 如 /index, /admin/id 等.
 // - c:              controller 的接口对象.
-// - mappingMethods: 不定项的路由参数, 用于自定义路由方法时候, 如 “post:postRouter,get:getIndex”.
-func (p *ControllerRegistor) Add(pattern string, c ControllerInterface, mappingMethods ...string) {
-	j := 0
-	params := make(map[int]string)
+// - mappingMethods: 不定项的路由参数, 用于自定义路由方法时候, 如 “post:postRouter;get:getIndex”.
+// Return:
+// - route:          添加的路由, 可以通过 route.Filter 绑定只作用于此路由的过滤函数.
+func (p *ControllerRegistor) Add(pattern string, c ControllerInterface, mappingMethods ...string) (route *Route) {
+	return p.AddNamed("", pattern, c, mappingMethods...)
+}
+
+// AddNamed 添加一个命名路由, 用法同 Add, 之后可以通过 URLFor(name) 反向生成 url.
+// Parameters:
+// - name:           路由名称, 为空时只能通过 Controller.Method 的方式反向生成 url.
+// - pattern:        注册的路由 URI, 如 /index, /admin/id 等.
+// - c:              controller 的接口对象.
+// - mappingMethods: 不定项的路由参数, 用于自定义路由方法时候, 如 “post:postRouter;get:getIndex”.
+// Return:
+// - route:          添加的路由.
+func (p *ControllerRegistor) AddNamed(name, pattern string, c ControllerInterface, mappingMethods ...string) (route *Route) {
+	return &Route{info: p.addRoute("", name, pattern, c, mappingMethods...)}
+}
+
+// AddHost 添加一个绑定域名的路由, 用法同 Add, 只有请求的域名匹配 host 时才会匹配此路由,
+// host 中可以使用参数, 如 :tenant.example.com, 通过 Input.Param(":tenant") 获取.
+// 请求的域名上没有匹配的路由时, 继续查找没有绑定域名的路由.
+// Parameters:
+// - host:           绑定的域名, 如 admin.example.com, :tenant.example.com.
+// - pattern:        注册的路由 URI, 如 /index, /admin/id 等.
+// - c:              controller 的接口对象.
+// - mappingMethods: 不定项的路由参数, 用于自定义路由方法时候, 如 “post:postRouter;get:getIndex”.
+// Return:
+// - route:          添加的路由.
+func (p *ControllerRegistor) AddHost(host, pattern string, c ControllerInterface, mappingMethods ...string) (route *Route) {
+	return &Route{info: p.addRoute(host, "", pattern, c, mappingMethods...)}
+}
+
+// addRoute 解析并添加路由.
+// Parameters:
+// - host:           绑定的域名, 可以为空.
+// - name:           路由名称, 可以为空.
+// - pattern:        注册的路由 URI.
+// - c:              controller 的接口对象.
+// - mappingMethods: 不定项的路由参数.
+// Return:
+// - route:          添加的路由信息, 添加失败时为 nil.
+func (p *ControllerRegistor) addRoute(host, name, pattern string, c ControllerInterface, mappingMethods ...string) (route *controllerInfo) {
+	reflectVal := reflect.ValueOf(c)
+	t := reflect.Indirect(reflectVal).Type()
+	methods := make(map[string]string)
+	actionParams := make(map[string][]string)
+
+	// 解析自定义方法, 如 "get,post:ApiFunc;delete:DeleteFunc", 方法带有参数时为 "get:ListFood(id,page,q)".
+	if len(mappingMethods) > 0 {
+		for _, mapping := range strings.Split(mappingMethods[0], ";") {
+			colon := strings.Split(mapping, ":")
+			if len(colon) != 2 {
+				p.routeError(fmt.Errorf("%s method mapping format error: %s", pattern, mapping))
+				return nil
+			}
+			funcName, params, err := parseActionMapping(reflectVal, colon[1])
+			if err != nil {
+				p.routeError(fmt.Errorf("%s %v", pattern, err))
+				return nil
+			}
+			if len(params) > 0 {
+				actionParams[funcName] = params
+			}
+			for _, m := range strings.Split(colon[0], ",") {
+				m = strings.ToLower(strings.TrimSpace(m))
+				if m != "*" && !util.InSlice(m, HTTPMETHOD) {
+					p.routeError(fmt.Errorf("%s is not a supported http method", m))
+					return nil
+				}
+				methods[m] = funcName
+			}
+		}
+	}
+
+	route = &controllerInfo{}
+	route.pattern = pattern
+	route.host = strings.ToLower(host)
+	route.controllerType = t
+	route.methods = methods
+	route.actionParams = actionParams
+	if len(methods) > 0 {
+		route.hasMethod = true
+	}
+	route.overridden = overriddenMethods(t)
+	if !p.addToRouter(route) {
+		return nil
+	}
+	p.addNamedRouter(name, route)
+
+	return
+}
+
+// addNamedRouter 记录路由的名称以及 Controller.Method, 同一个 Controller.Method 以第一次注册的路由为准,
+// 名称重复时记录到 RouteErrors 中, 路由仍然有效但是不能通过这个名称生成 url.
+// Parameters:
+// - name:  路由名称, 可以为空.
+// - route: 路由信息.
+func (p *ControllerRegistor) addNamedRouter(name string, route *controllerInfo) {
+	if name != "" {
+		if _, ok := p.namedRouters[name]; ok {
+			p.routeError(fmt.Errorf("route name %s already exists, ignored for %s", name, route.pattern))
+		} else {
+			p.namedRouters[name] = route
+		}
+	}
+
+	if route.controllerType == nil {
+		return
+	}
+
+	var runMethods []string
+	if route.hasMethod {
+		for _, m := range route.methods {
+			runMethods = append(runMethods, m)
+		}
+	} else {
+		for _, m := range HTTPMETHOD {
+			runMethods = append(runMethods, strings.Title(m))
+		}
+	}
+	for _, m := range runMethods {
+		endpoint := route.controllerType.Name() + "." + m
+		if _, ok := p.namedRouters[endpoint]; !ok {
+			p.namedRouters[endpoint] = route
+		}
+	}
+}
+
+// URLFor 通过路由名称或者 Controller.Method 以及参数反向生成 url,
+// values 为 key, value 交替的参数, 路由中的参数如 :id 填入 url, 其余的参数作为 query string,
+// 例如路由 Add("/user/:id:int", &UserController{}, "get:Info"),
+// URLFor("UserController.Info", ":id", 12, "page", 2) 返回 /user/12?page=2.
+// Parameters:
+// - endpoint: 路由名称或者 Controller.Method.
+// - values:   key, value 交替的参数, 路由参数的 key 可以带 ":" 也可以不带.
+// Return:
+// - u:        生成的 url, 路由不存在或者缺少路由参数时为空.
+func (p *ControllerRegistor) URLFor(endpoint string, values ...interface{}) (u string) {
+	route, ok := p.namedRouters[endpoint]
+	if !ok {
+		Debugf("urlfor: endpoint %s not found", endpoint)
+		return
+	}
+
+	params := make(map[string]string)
+	var keys []string
+	for i := 0; i+1 < len(values); i += 2 {
+		key := strings.TrimPrefix(fmt.Sprint(values[i]), ":")
+		if _, ok := params[key]; !ok {
+			keys = append(keys, key)
+		}
+		params[key] = fmt.Sprint(values[i+1])
+	}
+
+	u, used, err := buildURL(route.pattern, params)
+	if err != nil {
+		Debugf("urlfor: %s %v", endpoint, err)
+		return
+	}
+
+	query := url.Values{}
+	for _, k := range keys {
+		if !used[k] {
+			query.Add(k, params[k])
+		}
+	}
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	return
+}
+
+// buildURL 将参数填入路由 URI, 支持 :id, :id:int, :name:string, :id([0-9]+), cms_:id.html, * 和 *.*,
+// 可选参数 ?:id 缺少时去掉所在的一段, 如 /user/?:id 生成 /user.
+// Parameters:
+// - pattern: 注册的路由 URI.
+// - params:  参数, key 不带 ":".
+// Return:
+// - u:       生成的 url.
+// - used:    填入 url 的参数.
+// - err:     缺少参数.
+func buildURL(pattern string, params map[string]string) (u string, used map[string]bool, err error) {
+	used = make(map[string]bool)
+	lookup := func(key string, escape bool) (string, error) {
+		v, ok := params[key]
+		if !ok {
+			return "", fmt.Errorf("missing param :%s in %s", key, pattern)
+		}
+		used[key] = true
+		if escape {
+			v = url.PathEscape(v)
+		}
+		return v, nil
+	}
+
 	parts := strings.Split(pattern, "/")
+	segs := parts[:0]
 	for i, part := range parts {
-		// 正则路由.
-		if strings.HasPrefix(part, ":") {
-			expr := "(.*)"
-			if index := strings.Index(part, "("); index != -1 {
-				expr = part[index:]
-				part = part[:index]
-				// 匹配 /user/:id:int 正则路由到 /user/:id:([0-9]+).
-				// 匹配 /post/:username:string 正则路由到 /user/:username:([\w]+).
-			} else if lindex := strings.LastIndex(part, ":"); lindex != 0 {
-				switch part[lindex:] {
-				case ":int":
-					expr = "([0-9]+)"
-					part = part[:lindex]
-				case ":string":
-					expr = `([\w]+)`
-					part = part[:lindex]
-				}
+		var v string
+		switch {
+		case part == "*":
+			if v, err = lookup("splat", false); err != nil {
+				return
 			}
-			params[j] = part
-			parts[i] = expr
-			j++
-		}
-		// *全匹配方式 (*.*) 通过 :path 和 :ext 获取参数.
-		// (.*) 通过 :splat 获取参数.
-		if strings.HasPrefix(part, "*") {
-			expr := "(.*)"
-			if part == "*.*" {
-				params[j] = ":path"
-				parts[i] = "([^.]+).([^.]+)"
-				j++
-				params[j] = ":ext"
-				j++
-			} else {
-				params[j] = ":splat"
-				parts[i] = expr
-				j++
+			parts[i] = v
+		case part == "*.*":
+			if v, err = lookup("path", false); err != nil {
+				return
 			}
-		}
-		// 匹配 someprefix:id(xxx).html 的 url.
-		if strings.Contains(part, ":") && strings.Contains(part, "(") && strings.Contains(part, ")") {
-			var out []rune
-			var start bool
-			var startexp bool
-			var param []rune
-			var expt []rune
-			for _, v := range part {
-				if start {
-					if v != '(' {
-						param = append(param, v)
-						continue
-					}
+			parts[i] = v
+			if v, err = lookup("ext", true); err != nil {
+				return
+			}
+			parts[i] += "." + v
+		case strings.Contains(part, ":"):
+			var out []byte
+			optional := strings.Contains(part, "?")
+			for j := 0; j < len(part); {
+				if part[j] == '?' {
+					j++
+					continue
 				}
-				if startexp {
-					if v != ')' {
-						expt = append(expt, v)
-						continue
+				if part[j] != ':' {
+					out = append(out, part[j])
+					j++
+					continue
+				}
+				// 参数名称.
+				k := j + 1
+				for k < len(part) && (part[k] == '_' || part[k] >= 'a' && part[k] <= 'z' ||
+					part[k] >= 'A' && part[k] <= 'Z' || part[k] >= '0' && part[k] <= '9') {
+					k++
+				}
+				if v, err = lookup(part[j+1:k], true); err != nil {
+					if optional {
+						err, out = nil, nil
+						break
 					}
+					return
 				}
-				if v == ':' {
-					param = make([]rune, 0)
-					param = append(param, ':')
-					start = true
-				} else if v == '(' {
-					startexp = true
-					start = false
-					params[j] = string(param)
-					j++
-					expt = make([]rune, 0)
-					expt = append(expt, '(')
-				} else if v == ')' {
-					startexp = false
-					expt = append(expt, ')')
-					out = append(out, expt...)
-				} else {
-					out = append(out, v)
+				out = append(out, v...)
+				// 跳过参数类型 :int, :string 等或者正则 (...).
+				if k < len(part) && part[k] == ':' {
+					if name, pt := lookupParamType(part[k+1:]); pt != nil {
+						k += len(name) + 1
+					}
+				} else if k < len(part) && part[k] == '(' {
+					for depth := 0; k < len(part); k++ {
+						if part[k] == '(' {
+							depth++
+						} else if part[k] == ')' {
+							depth--
+							if depth == 0 {
+								k++
+								break
+							}
+						}
+					}
 				}
+				j = k
+			}
+			if optional && out == nil {
+				continue
 			}
 			parts[i] = string(out)
 		}
+		segs = append(segs, parts[i])
+	}
+	u = strings.Join(segs, "/")
+	if u == "" {
+		u = "/"
 	}
 
-	// TODO 智能路由 AutoRoute 模式, 通过反射获取集合.
+	return
+}
 
+// AddAuto 添加智能路由, 将 /<controller>/<method>/... 映射到 controller 的导出方法上,
+// controller 名称为去掉 Controller 后缀的类型名, controller 和方法名都不区分大小写,
+// 例如 UserController 的 List 方法对应 /user/list, /user 对应 Index 方法,
+// url 中剩余的部分按顺序放入 Input.Params, key 为 "0", "1" ...
+// exceptMethod 中的方法以及需要参数的方法不会被映射.
+// Parameters:
+// - c: controller 的接口对象.
+func (p *ControllerRegistor) AddAuto(c ControllerInterface) {
 	reflectVal := reflect.ValueOf(c)
-	t := reflect.Indirect(reflectVal).Type()
-	methods := make(map[string]string)
+	rt := reflectVal.Type()
+	ct := reflect.Indirect(reflectVal).Type()
+	controllerName := strings.TrimSuffix(ct.Name(), "Controller")
+
+	methods := make(map[string]reflect.Type)
+	for i := 0; i < rt.NumMethod(); i++ {
+		m := rt.Method(i)
+		// 接收者之外没有参数的导出方法.
+		if util.InSlice(m.Name, exceptMethod) || m.Type.NumIn() != 1 {
+			continue
+		}
+		methods[strings.ToLower(m.Name)] = ct
 
-	// 创建固定路由.
-	if j == 0 {
 		route := &controllerInfo{}
-		route.pattern = pattern
-		route.controllerType = t
-		route.methods = methods
-		if len(methods) > 0 {
-			route.hasMethod = true
+		route.pattern = "/" + strings.ToLower(controllerName) + "/" + strings.ToLower(m.Name)
+		route.controllerType = ct
+		route.methods = map[string]string{"*": m.Name}
+		route.hasMethod = true
+		route.auto = true
+		p.routes = append(p.routes, route)
+		p.addNamedRouter("", route)
+	}
+	p.autoRouter[strings.ToLower(controllerName)] = methods
+	p.enableAuto = true
+}
+
+// findAutoRouter 查找智能路由.
+// Parameters:
+// - urlPath: 请求的 url path.
+// Return:
+// - controllerType: controller 类型.
+// - runMethod:      运行的 controller 方法.
+// - params:         url 中 controller 和方法之后的部分.
+func (p *ControllerRegistor) findAutoRouter(urlPath string) (controllerType reflect.Type, runMethod string, params map[string]string) {
+	segments := splitPath(urlPath)
+	if len(segments) == 0 {
+		return
+	}
+	methods, ok := p.autoRouter[strings.ToLower(segments[0])]
+	if !ok {
+		return
+	}
+	method := "index"
+	if len(segments) > 1 {
+		method = strings.ToLower(segments[1])
+	}
+	if controllerType, ok = methods[method]; !ok {
+		return
+	}
+
+	// 通过反射获得方法的真实名称.
+	pt := reflect.PtrTo(controllerType)
+	for i := 0; i < pt.NumMethod(); i++ {
+		if strings.ToLower(pt.Method(i).Name) == method {
+			runMethod = pt.Method(i).Name
+			break
 		}
-		p.fixrouters = append(p.fixrouters, route)
-	} else {
-		// 创建正则路由.
-		// 重新更新 url 模式为正则表达式并且编译正则表达式.
-		pattern = strings.Join(parts, "/")
-		regex, err := regexp.Compile(pattern)
-		if err != nil {
-			fmt.Println(comm.WrapError(err))
-			return
+	}
+	params = make(map[string]string)
+	if len(segments) > 2 {
+		for i, v := range segments[2:] {
+			params[strconv.Itoa(i)] = v
+		}
+	}
+
+	return
+}
+
+// AddFunc 添加函数路由, 请求直接交给处理函数, 不会通过反射创建 controller,
+// 和 controller 路由一样经过过滤函数, session, xsrf 和 access log,
+// 例如 AddFunc("get,post", "/api/ping", func(ctx *context.Context) { ctx.WriteString("pong") }).
+// Parameters:
+// - methods: 逗号分隔的 http 方法, 如 get, "get,post", "*" 表示所有方法.
+// - pattern: 注册的路由 URI, 如 /index, /admin/id 等.
+// - f:       处理函数.
+// Return:
+// - route:   添加的路由.
+func (p *ControllerRegistor) AddFunc(methods, pattern string, f HandlerFunc) (route *Route) {
+	return &Route{info: p.addFuncRoute("", methods, pattern, f)}
+}
+
+// addFuncRoute 解析并添加函数路由.
+// Parameters:
+// - host:    绑定的域名, 可以为空.
+// - methods: 逗号分隔的 http 方法.
+// - pattern: 注册的路由 URI.
+// - f:       处理函数.
+// Return:
+// - route:   添加的路由信息, 添加失败时为 nil.
+func (p *ControllerRegistor) addFuncRoute(host, methods, pattern string, f HandlerFunc) (route *controllerInfo) {
+	route = &controllerInfo{}
+	route.pattern = pattern
+	route.host = strings.ToLower(host)
+	route.handler = f
+	route.methods = make(map[string]string)
+	for _, m := range strings.Split(methods, ",") {
+		m = strings.ToLower(strings.TrimSpace(m))
+		if m != "*" && !util.InSlice(m, HTTPMETHOD) {
+			p.routeError(fmt.Errorf("%s is not a supported http method", m))
+			return nil
 		}
+		route.methods[m] = strings.Title(m)
+	}
+	route.hasMethod = true
+	if !p.addToRouter(route) {
+		return nil
+	}
+
+	return
+}
+
+// Route 添加的路由, 用于绑定只作用于此路由的过滤函数, 例如
+// p.Add("/admin", &AdminController{}).Filter(BEFORE_EXEC, checkAdmin).
+type Route struct {
+	// 路由信息, 添加失败时为 nil.
+	info *controllerInfo
+}
+
+// Filter 为路由绑定过滤函数, 过滤函数在同一位置上全局的过滤函数之后, 按照绑定的顺序执行,
+// 路由在过滤函数执行之前才能确定, 所以只支持 BEFORE_EXEC 和 AFTER_EXEC.
+// 过滤函数的名称为函数名, 可以通过 RemoveFilter 和 ReplaceFilter 删除或者替换, 匿名函数没有名称, 不能删除或者替换.
+// Parameters:
+// - pos:    过滤函数执行的位置, BEFORE_EXEC 或者 AFTER_EXEC.
+// - filter: 过滤函数.
+// - params: 同 InsertFilter 的 returnOnOutput.
+// Return:
+// - route:  路由本身, 便于链式调用.
+func (r *Route) Filter(pos int, filter FilterFunc, params ...bool) (route *Route) {
+	if r.info == nil {
+		return r
+	}
+	if pos != BEFORE_EXEC && pos != AFTER_EXEC {
+		fmt.Println(comm.WrapError(fmt.Errorf("route filter of %s only supports BEFORE_EXEC and AFTER_EXEC", r.info.pattern)))
+		return r
+	}
 
-		// 创建路由.
+	mr := new(FilterRouter)
+	mr.pattern = r.info.pattern
+	mr.filterFunc = filter
+	mr.name = filterName(filter)
+	mr.returnOnOutput = len(params) == 0 || params[0]
+	if r.info.filters == nil {
+		r.info.filters = make(map[int][]*FilterRouter)
+	}
+	r.info.filters[pos] = append(r.info.filters[pos], mr)
+
+	return r
+}
+
+// Timeout 设置路由的超时时间, 覆盖全局的 [web] requesttimeout, 超时之后 Ctx.Context() 被取消,
+// 还没有输出时返回 503, 例如 p.Add("/report", &ReportController{}).Timeout(30 * time.Second).
+// Parameters:
+// - d:     超时时间.
+// Return:
+// - route: 路由本身, 便于链式调用.
+func (r *Route) Timeout(d time.Duration) (route *Route) {
+	if r.info != nil {
+		r.info.timeout = d
+	}
+	return r
+}
+
+// Handler 将 http.Handler 挂载到 prefix 下, prefix 本身以及 prefix 下的所有 url 都交给 h 处理,
+// 例如 Handler("/debug/pprof", http.HandlerFunc(pprof.Index), false).
+// 挂载的 handler 只经过 BEFORE_STATIC 和 BEFORE_ROUTER 过滤函数, 并记录 access log,
+// 不会开启 xsrf 校验, 也不会执行 BEFORE_EXEC 和 AFTER_EXEC 过滤函数.
+// Parameters:
+// - prefix:      挂载的 url 前缀, 如 /debug/pprof.
+// - h:           http.Handler.
+// - stripPrefix: 是否在交给 h 之前去掉 url 中的 prefix.
+func (p *ControllerRegistor) Handler(prefix string, h http.Handler, stripPrefix bool) {
+	prefix = strings.TrimRight(joinPattern("", prefix), "/")
+	if stripPrefix {
+		h = http.StripPrefix(prefix, h)
+	}
+
+	for _, pattern := range []string{prefix, prefix + "/*"} {
+		if pattern == "" {
+			pattern = "/"
+		}
 		route := &controllerInfo{}
-		route.regex = regex
-		route.params = params
 		route.pattern = pattern
-		route.methods = methods
-		if len(methods) > 0 {
-			route.hasMethod = true
+		route.httpHandler = h
+		route.methods = map[string]string{"*": "ServeHTTP"}
+		route.hasMethod = true
+		p.addToRouter(route)
+	}
+}
+
+// addToRouter 将路由加入到对应 http 方法的路由树中,
+// 没有自定义方法或者自定义了 "*" 的路由会加入到所有方法的路由树中.
+// 非法的路由 URI 以及重复的路由不会被加入, 被遮蔽的路由仍然会被加入, 都会记录到 RouteErrors 中.
+// Parameters:
+// - route: 路由信息.
+// Return:
+// - ok:    路由是否加入到路由树中.
+func (p *ControllerRegistor) addToRouter(route *controllerInfo) (ok bool) {
+	pattern := route.pattern
+	if !RouterCaseSensitive {
+		pattern = strings.ToLower(pattern)
+	}
+
+	var err error
+	if route.segments, route.priority, err = parseRouteSegments(pattern); err != nil {
+		p.routeError(err)
+		return false
+	}
+	duplicate, shadowed := p.checkRoute(route)
+	if duplicate != nil {
+		p.routeError(fmt.Errorf("duplicate route %s%s, already registered as %s%s",
+			route.host, route.pattern, duplicate.host, duplicate.pattern))
+		return false
+	}
+	if shadowed != nil {
+		p.routeError(fmt.Errorf("route %s%s is shadowed by %s%s and will never be matched",
+			route.host, route.pattern, shadowed.host, shadowed.pattern))
+	}
+	route.converters = routeConverters(route.pattern)
+	p.routes = append(p.routes, route)
+
+	methods := routeMethods(route)
+	routers := p.routers
+	if route.host != "" {
+		hr, ok := p.hostRouters[route.host]
+		if !ok {
+			hr = &hostRouter{host: route.host, routers: make(map[string]*Tree)}
+			p.hostRouters[route.host] = hr
+			p.hostTree.AddRouter(hostPath(route.host), hr)
+		}
+		routers = hr.routers
+	}
+	for _, m := range methods {
+		tree, ok := routers[m]
+		if !ok {
+			tree = NewTree()
+			routers[m] = tree
+		}
+		tree.AddRouter(pattern, route)
+	}
+
+	return true
+}
+
+// hostPath 将域名按 "." 反转成路径, 用于在路由树中匹配域名.
+// "admin.example.com" -> "/com/example/admin"
+// ":tenant.example.com" -> "/com/example/:tenant"
+func hostPath(host string) string {
+	labels := strings.Split(strings.Trim(host, "."), ".")
+	for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+		labels[i], labels[j] = labels[j], labels[i]
+	}
+
+	return "/" + strings.Join(labels, "/")
+}
+
+// findRouter 在 http 方法对应的路由树中查找路由, 查找的代价只和 url 的段数有关, 和注册的路由数量无关,
+// 优先查找绑定到请求域名上的路由, 没有找到时查找没有绑定域名的路由.
+// Parameters:
+// - host:    请求的域名, 不含端口.
+// - method:  小写的 http 方法, 如 get, post 等.
+// - urlPath: 请求的 url path.
+// Return:
+// - route:   找到的路由, 没有找到为 nil.
+// - params:  url 以及域名中解析出的参数, 如 :id, :splat, :tenant 等.
+func (p *ControllerRegistor) findRouter(host, method, urlPath string) (route *controllerInfo, params map[string]string) {
+	if host != "" && len(p.hostRouters) > 0 {
+		if runObject, hostParams := p.hostTree.Match(hostPath(strings.ToLower(host))); runObject != nil {
+			if route, params = matchRouters(runObject.(*hostRouter).routers, method, urlPath); route != nil {
+				if len(hostParams) > 0 {
+					if params == nil {
+						params = make(map[string]string)
+					}
+					for k, v := range hostParams {
+						params[k] = v
+					}
+				}
+				return
+			}
 		}
-		route.controllerType = t
-		p.routers = append(p.routers, route)
 	}
+
+	return matchRouters(p.routers, method, urlPath)
+}
+
+// matchRouters 在 http 方法对应的路由树中匹配 url.
+func matchRouters(routers map[string]*Tree, method, urlPath string) (route *controllerInfo, params map[string]string) {
+	tree, ok := routers[method]
+	if !ok {
+		return
+	}
+	runObject, params := tree.Match(urlPath)
+	if runObject == nil {
+		return nil, nil
+	}
+	route, _ = runObject.(*controllerInfo)
+
+	return
 }
 
 // getErrorHandler 从 middleware 获取 err handler
@@ -250,15 +792,62 @@ func (p *ControllerRegistor) getErrorHandler(errorCode string) (handler func(rw
 	return
 }
 
-// getRunMethod 从 request header 或者表单中获取请求的方法名称,
-// 有些时候某些浏览器不能创建 create 和 delete 请求, 使用 _method 代替.
+// handleAbort 处理 Context.Abort 以及 StopRun 抛出的 HTTPException, 还没有输出时输出 body 或者错误页面.
+// Parameters:
+// - err: recover 得到的值.
+// - w:   当前请求的 responseWriter.
+// - r:   http.Request.
+// Return:
+// - ok:  err 是否为 HTTPException, 其他的 panic 需要继续处理.
+func (p *ControllerRegistor) handleAbort(err interface{}, w *responseWriter, r *http.Request) (ok bool) {
+	var e *middleware.HTTPException
+	switch err := err.(type) {
+	case *middleware.HTTPException:
+		e = err
+	case middleware.HTTPException:
+		e = &err
+	default:
+		return false
+	}
+	if e.StatusCode == 0 || w.started {
+		return true
+	}
+
+	if e.Description == "" {
+		middleware.Exception(strconv.Itoa(e.StatusCode), w, r, fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode)))
+		return true
+	}
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	w.WriteHeader(e.StatusCode)
+	io.WriteString(w, e.Description)
+
+	return true
+}
+
+// abortable 执行 f, 处理 f 中的 Abort 以及 StopRun, 其他的 panic 继续抛出.
+// Parameters:
+// - w: 当前请求的 responseWriter.
+// - r: http.Request.
+// - f: 要执行的函数.
+func (p *ControllerRegistor) abortable(w *responseWriter, r *http.Request, f func()) {
+	defer func() {
+		if err := recover(); err != nil && !p.handleAbort(err, w, r) {
+			panic(err)
+		}
+	}()
+	f()
+}
+
+// getHTTPMethod 从 request header 或者表单中获取请求的 http 方法,
+// 有些时候某些浏览器不能创建 put 和 delete 请求, 使用 _method 代替.
 // Parameters:
 // - method:  http 方法, 如 GET、POST 等.
 // - context: fargo 上下文.
-// - router:  每一个对应的 controller 集合.
 // Return；
-// - m:       运行的 http 方法.
-func (p *ControllerRegistor) getRunMethod(method string, context *fargocontext.Context, router *controllerInfo) (m string) {
+// - m:       小写的 http 方法.
+func (p *ControllerRegistor) getHTTPMethod(method string, context *fargocontext.Context) (m string) {
 	method = strings.ToLower(method)
 	if method == "post" && strings.ToLower(context.Input.Query("_method")) == "put" {
 		method = "put"
@@ -266,6 +855,17 @@ func (p *ControllerRegistor) getRunMethod(method string, context *fargocontext.C
 	if method == "post" && strings.ToLower(context.Input.Query("_method")) == "delete" {
 		method = "delete"
 	}
+
+	return method
+}
+
+// getRunMethod 获取路由上 http 方法对应的 controller 方法名称.
+// Parameters:
+// - method:  小写的 http 方法, 如 get、post 等.
+// - router:  每一个对应的 controller 集合.
+// Return；
+// - m:       运行的 controller 方法.
+func (p *ControllerRegistor) getRunMethod(method string, router *controllerInfo) (m string) {
 	if router.hasMethod {
 		if m, ok := router.methods[method]; ok {
 			return m
@@ -274,9 +874,107 @@ func (p *ControllerRegistor) getRunMethod(method string, context *fargocontext.C
 		} else {
 			return ""
 		}
-	} else {
+	} else if router.overridden[method] {
 		return strings.Title(method)
 	}
+
+	return ""
+}
+
+// allowedMethods 获取 url 上可以使用的 http 方法, 用于 405 和 OPTIONS 请求的 Allow header,
+// 只要有一个方法可以使用, 就会自动支持 OPTIONS, 支持 GET 时会自动支持 HEAD.
+// Parameters:
+// - host:    请求的域名, 不含端口.
+// - version: 请求的 API 版本, 可以为空.
+// - urlPath: 请求的 url path.
+// Return:
+// - allow:   大写的 http 方法, 没有匹配的路由时为空.
+func (p *ControllerRegistor) allowedMethods(host, version, urlPath string) (allow []string) {
+	for _, m := range HTTPMETHOD {
+		if route, _ := p.findVersionRouter(host, version, m, urlPath); route != nil && p.getRunMethod(m, route) != "" {
+			allow = append(allow, strings.ToUpper(m))
+		}
+	}
+	if len(allow) == 0 {
+		return
+	}
+	if util.InSlice("GET", allow) && !util.InSlice("HEAD", allow) {
+		allow = append(allow, "HEAD")
+	}
+	if !util.InSlice("OPTIONS", allow) {
+		allow = append(allow, "OPTIONS")
+	}
+
+	return
+}
+
+// baseControllerType fargo.Controller 的类型, 它的 Get、Post 等方法默认返回 405.
+var baseControllerType = reflect.TypeOf(Controller{})
+
+// overriddenMethods 通过反射获取 controller 重写了的 http 方法, 即不是从 fargo.Controller 继承来的 Get、Post 等.
+// Parameters:
+// - t: controller 的类型.
+// Return:
+// - overridden: key: 小写的 http 方法.
+func overriddenMethods(t reflect.Type) (overridden map[string]bool) {
+	overridden = make(map[string]bool)
+	for _, m := range HTTPMETHOD {
+		if isOverridden(t, strings.Title(m)) {
+			overridden[m] = true
+		}
+	}
+
+	return
+}
+
+// isOverridden 判断类型 t 上的方法 name 是否由 t 本身或者嵌入的非 fargo.Controller 类型定义.
+// 由嵌入字段提升而来的方法在反射中是编译器生成的包装函数, 此时继续在嵌入字段中查找.
+func isOverridden(t reflect.Type, name string) bool {
+	if t == baseControllerType {
+		return false
+	}
+	pt := reflect.PtrTo(t)
+	m, ok := pt.MethodByName(name)
+	if !ok {
+		return false
+	}
+	if !isWrapperFunc(m.Func) {
+		return true
+	}
+	// 值接收者定义的方法.
+	if vm, ok := t.MethodByName(name); ok && !isWrapperFunc(vm.Func) {
+		return true
+	}
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.Anonymous {
+			continue
+		}
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if _, ok := reflect.PtrTo(ft).MethodByName(name); ok {
+			return isOverridden(ft, name)
+		}
+	}
+
+	return false
+}
+
+// isWrapperFunc 判断函数是否为编译器生成的包装函数.
+func isWrapperFunc(fn reflect.Value) bool {
+	pc := fn.Pointer()
+	f := runtime.FuncForPC(pc)
+	if f == nil {
+		return false
+	}
+	file, _ := f.FileLine(pc)
+
+	return file == "<autogenerated>"
 }
 
 // responseWriter 是 http.ResponseWriter 的封装,
@@ -288,11 +986,23 @@ type responseWriter struct {
 	// 是否已经开始.
 	started bool
 
-	// response 的 状态.
+	// response 的 状态, 第一次输出的状态码, 只写入 body 时为 200.
 	status int
 
+	// 写入 body 的字节数.
+	bytes int64
+
+	// 第一次输出 header 或者 body 的时间.
+	firstByte time.Time
+
 	// 输出编码状态, 是否需要压缩等.
 	contentEncoding string
+
+	// 请求开始的时间.
+	start time.Time
+
+	// 连接是否已经被 hijack, hijack 之后不再被复用.
+	hijacked bool
 }
 
 // Header 返回 发送到 WriteHeader 的 header map.
@@ -321,7 +1031,10 @@ func (r *responseWriter) InitHeadContent(contentLength int64) {
 // - p: 写回的数据.
 func (r *responseWriter) Write(p []byte) (int, error) {
 	r.started = true
-	return r.writer.Write(p)
+	r.record(http.StatusOK)
+	n, err := r.writer.Write(p)
+	r.bytes += int64(n)
+	return n, err
 }
 
 // WriteHeader 发送带有 status code 的 HTTP response header,
@@ -330,10 +1043,49 @@ func (r *responseWriter) Write(p []byte) (int, error) {
 // - code: 状态码.
 func (r *responseWriter) WriteHeader(code int) {
 	r.started = true
-	r.status = code
+	r.record(code)
 	r.writer.WriteHeader(code)
 }
 
+// record 记录第一次输出的时间和状态码, 1xx 的状态码之后还会有最终的状态码.
+// Parameters:
+// - code: 状态码.
+func (r *responseWriter) record(code int) {
+	if r.firstByte.IsZero() {
+		r.firstByte = time.Now()
+	}
+	if r.status == 0 || r.status < 200 {
+		r.status = code
+	}
+}
+
+// Status 返回已经输出的状态码, 还没有输出时为 0.
+func (r *responseWriter) Status() int {
+	return r.status
+}
+
+// BytesWritten 返回已经写入 body 的字节数.
+func (r *responseWriter) BytesWritten() int64 {
+	return r.bytes
+}
+
+// TimeToFirstByte 返回从请求开始到第一次输出的时间, 还没有输出时为 0.
+func (r *responseWriter) TimeToFirstByte() time.Duration {
+	if r.firstByte.IsZero() {
+		return 0
+	}
+	return r.firstByte.Sub(r.start)
+}
+
+// Flush 将缓冲的数据发送到客户端, 实现 http.Flusher 接口, 供挂载的 http.Handler 使用.
+func (r *responseWriter) Flush() {
+	if f, ok := r.writer.(http.Flusher); ok {
+		r.started = true
+		r.record(http.StatusOK)
+		f.Flush()
+	}
+}
+
 // Hijack 将 writer 转换成 hijack.
 // HTTP 包中封装了 Hijacker 接口, 允许程序被接替, 详见 net/http 包.
 func (r *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
@@ -342,11 +1094,16 @@ func (r *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 		println("supported?")
 		return nil, nil, fmt.Errorf("webserver doesn't support hijacking")
 	}
-	return hj.Hijack()
+	conn, buf, err := hj.Hijack()
+	if err == nil {
+		r.hijacked = true
+	}
+	return conn, buf, err
 }
 
 // CloseNotify 方法用于获取客户端连接是否断开.
 // 返回是个channel，如果从channel中读取到数据，说明连接断开了
+// Deprecated: 使用 Ctx.Context().Done(), 客户端断开连接时 context 会被取消.
 func (r *responseWriter) CloseNotify() <-chan bool {
 	if cnotifier, ok := r.writer.(http.CloseNotifier); ok {
 		// http.ResponseWriter 实现了CloseNotify接口
@@ -359,11 +1116,37 @@ func (r *responseWriter) CloseNotify() <-chan bool {
 // InsertFilter Add a FilterFunc with pattern rule and action constant.
 // The bool params is for setting the returnOnOutput value (false allows multiple filters to execute)
 func (p *ControllerRegistor) InsertFilter(pattern string, pos int, filter FilterFunc, params ...bool) error {
+	return p.InsertNamedFilter("", pattern, pos, 0, filter, params...)
+}
+
+// InsertNamedFilter 添加带名称和优先级的过滤函数, 之后可以通过 RemoveFilter 和 ReplaceFilter 按名称删除或者替换,
+// 如测试中替换掉鉴权的过滤函数.
+// 同一个位置上的过滤函数按照优先级从小到大执行, 优先级相同时按照添加的顺序执行, InsertFilter 的优先级为 0.
+// Parameters:
+// - name:     过滤函数名称, 为空时使用函数名, 如 main.auth, 匿名函数的名称不稳定, 没有指定名称时不能删除或者替换.
+// - pattern:  过滤规则, 如 /admin/*.
+// - pos:      过滤函数执行的位置.
+// - priority: 优先级, 越小越先执行.
+// - filter:   过滤函数.
+// - params:   同 InsertFilter 的 returnOnOutput.
+// Return:
+// - err:      名称已经存在, 同时记录到 RouteErrors 中.
+func (p *ControllerRegistor) InsertNamedFilter(name, pattern string, pos, priority int, filter FilterFunc, params ...bool) (err error) {
+	if name != "" && p.findFilters(name) != nil {
+		err = fmt.Errorf("filter name %s already exists", name)
+		p.routeError(err)
+		return
+	}
 
 	mr := new(FilterRouter)
 	mr.tree = NewTree()
 	mr.pattern = pattern
 	mr.filterFunc = filter
+	mr.name = name
+	if name == "" {
+		mr.name = filterName(filter)
+	}
+	mr.priority = priority
 	if !RouterCaseSensitive {
 		pattern = strings.ToLower(pattern)
 	}
@@ -376,86 +1159,295 @@ func (p *ControllerRegistor) InsertFilter(pattern string, pos int, filter Filter
 	return p.insertFilterRouter(pos, mr)
 }
 
-// add Filter into
+// add Filter into, filters with the same priority keep the insertion order.
 func (p *ControllerRegistor) insertFilterRouter(pos int, mr *FilterRouter) error {
-	p.filters[pos] = append(p.filters[pos], mr)
+	l := p.filters[pos]
+	i := len(l)
+	for i > 0 && l[i-1].priority > mr.priority {
+		i--
+	}
+	l = append(l, nil)
+	copy(l[i+1:], l[i:])
+	l[i] = mr
+	p.filters[pos] = l
 	p.enableFilter = true
 	return nil
 }
 
+// findFilters 按名称查找过滤函数, 包括绑定到路由上的过滤函数.
+// Parameters:
+// - name: 过滤函数名称.
+// Return:
+// - filters: 名称相同的所有过滤函数.
+func (p *ControllerRegistor) findFilters(name string) (filters []*FilterRouter) {
+	for _, l := range p.filters {
+		for _, f := range l {
+			if f.name == name {
+				filters = append(filters, f)
+			}
+		}
+	}
+	for _, r := range p.routes {
+		for _, l := range r.filters {
+			for _, f := range l {
+				if f.name == name {
+					filters = append(filters, f)
+				}
+			}
+		}
+	}
+
+	return
+}
+
+// RemoveFilter 按名称删除过滤函数, 包括绑定到路由上的过滤函数.
+// Parameters:
+// - name: 过滤函数名称, InsertNamedFilter 的 name 或者函数名, 不能为空.
+// Return:
+// - ok:   是否删除了过滤函数.
+func (p *ControllerRegistor) RemoveFilter(name string) (ok bool) {
+	if name == "" {
+		return false
+	}
+	remove := func(l []*FilterRouter) []*FilterRouter {
+		n := 0
+		for _, f := range l {
+			if f.name == name {
+				ok = true
+				continue
+			}
+			l[n] = f
+			n++
+		}
+		return l[:n]
+	}
+	for pos, l := range p.filters {
+		p.filters[pos] = remove(l)
+	}
+	for _, r := range p.routes {
+		for pos, l := range r.filters {
+			r.filters[pos] = remove(l)
+		}
+	}
+
+	return
+}
+
+// ReplaceFilter 按名称替换过滤函数, 过滤规则, 位置, 优先级以及分组绑定的域名和版本保持不变.
+// Parameters:
+// - name:   过滤函数名称, InsertNamedFilter 的 name 或者函数名, 不能为空.
+// - filter: 新的过滤函数.
+// Return:
+// - ok:     是否替换了过滤函数.
+func (p *ControllerRegistor) ReplaceFilter(name string, filter FilterFunc) (ok bool) {
+	if name == "" {
+		return false
+	}
+	for _, f := range p.findFilters(name) {
+		f.filterFunc = filter
+		ok = true
+	}
+
+	return
+}
+
+// Use 添加中间件, 中间件包裹整个请求的分发过程, 包括静态文件, 路由, 过滤函数以及 controller,
+// 先添加的中间件在外层, 可以用于计时, recover, 替换 ctx.ResponseWriter 改写输出等, 例如:
+//
+//	p.Use(func(next HandlerFunc) HandlerFunc {
+//		return func(ctx *context.Context) {
+//			start := time.Now()
+//			next(ctx)
+//			Debugf("%s %s", ctx.Input.URL(), time.Since(start))
+//		}
+//	})
+//
+// 中间件不调用 next 时请求不会被分发.
+// Parameters:
+// - middlewares: 中间件.
+func (p *ControllerRegistor) Use(middlewares ...Middleware) {
+	p.middlewares = append(p.middlewares, middlewares...)
+	h := HandlerFunc(p.dispatch)
+	for i := len(p.middlewares) - 1; i >= 0; i-- {
+		h = p.middlewares[i](h)
+	}
+	p.handler = h
+}
+
+// doFilter 执行 pos 位置上匹配 urlPath 的过滤函数.
+// BEFORE_STATIC, BEFORE_ROUTER 和 BEFORE_EXEC 的过滤函数设置了 returnOnOutput 并且已经输出时, 停止执行之后的过滤函数;
+// AFTER_EXEC 和 FINISH_ROUTER 在输出之后执行, 所有匹配的过滤函数都会执行.
+// Parameters:
+// - pos:     过滤函数执行的位置.
+// - context: 上下文.
+// - w:       response 的封装.
+// - urlPath: 用于匹配过滤规则的 url path.
+// Return:
+// - started: 是否已经输出并且需要停止处理请求.
+func (p *ControllerRegistor) doFilter(pos int, context *fargocontext.Context, w *responseWriter, urlPath string) (started bool) {
+	if !p.enableFilter {
+		return false
+	}
+
+	return execFilters(p.filters[pos], pos, context, w, urlPath)
+}
+
+// execFilters 依次执行匹配 urlPath 的过滤函数, 规则同 doFilter.
+// Parameters:
+// - filters: 过滤函数.
+// - pos:     过滤函数执行的位置.
+// - context: 上下文.
+// - w:       response 的封装.
+// - urlPath: 用于匹配过滤规则的 url path.
+// Return:
+// - started: 是否已经输出并且需要停止处理请求.
+func execFilters(filters []*FilterRouter, pos int, context *fargocontext.Context, w *responseWriter, urlPath string) (started bool) {
+	for _, filterR := range filters {
+		if ok, filterParams := filterR.ValidRouter(urlPath); ok && (filterR.match == nil || filterR.match(context)) {
+			// 过滤函数中可以同时获取路由参数和过滤规则中的参数, 执行完之后恢复路由参数.
+			routeParams := context.Input.Params
+			params := make(map[string]string, len(routeParams)+len(filterParams))
+			for k, v := range routeParams {
+				params[k] = v
+			}
+			for k, v := range filterParams {
+				params[k] = v
+			}
+			context.Input.Params = params
+			filterR.filterFunc(context)
+			context.Input.Params = routeParams
+			if pos < AFTER_EXEC && filterR.returnOnOutput && w.started {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// routerPath 返回用于匹配路由的 url path, 路由不区分大小写时为小写.
+func routerPath(r *http.Request) string {
+	if !RouterCaseSensitive {
+		return strings.ToLower(r.URL.Path)
+	}
+	return r.URL.Path
+}
+
 // ServeHTTP ControllerRegistor 实现了 http.Handler 接口, 而此接口实现了 ServeHTTP 方法,
 // 意味着每次 server accept 请求则会执行此方法,
 // 将请求和路由集合进行匹配, 通过反射进行路由.
 func (p *ControllerRegistor) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	// 从 pool 中获取 context 将 response 和 request 包入 Context 中, 请求结束之后放回.
+	context, w := acquireContext(rw, r)
+	defer releaseContext(context, w)
+	w.Header().Set("Server", gServerName)
+	context.Output.EnableGzip = enableGzip
+
+	// 每个请求记录一次 access log, 包括 Abort, StopRun, panic, 404 以及 405, 在 FINISH_ROUTER 之后执行.
+	if enableAccessLog {
+		defer accessLog(context, w)
+	}
+
+	// FINISH_ROUTER 的过滤函数在请求结束之后执行, 包括 404, 405 以及 panic.
+	defer p.abortable(w, r, func() { p.doFilter(FINISH_ROUTER, context, w, routerPath(r)) })
 
 	defer func() {
 		if err := recover(); err != nil {
+			// Abort 以及 StopRun.
+			if p.handleAbort(err, w, r) {
+				return
+			}
 			Log.Printf("the request url is %s ", r.URL.Path)
 			Log.Printf("crashed error is %v ", err)
 			Log.DumpStack()
-			if _, ok := err.(middleware.HTTPException); ok {
-				// 4xx 和 5xx 错误.
-			} else {
-				handler := p.getErrorHandler(fmt.Sprint(err))
-				handler(rw, r)
-				return
-			}
+			handler := p.getErrorHandler(fmt.Sprint(err))
+			handler(w, r)
 		}
 	}()
 
+	p.handler(context)
+
+	// 超时并且还没有输出时返回 503.
+	if context.Context().Err() == stdcontext.DeadlineExceeded && !w.started {
+		middleware.Exception("503", w, r, "503 Service Unavailable")
+	}
+}
+
+// accessLogInfoKey Controller.Accesslog 在 Input.Data 中的 key.
+const accessLogInfoKey = "fargo_accesslog"
+
+// accessLog 记录 access log, 状态码, 输出的字节数以及首字节时间来自最终的输出.
+// Parameters:
+// - context: 上下文.
+// - w:       封装之后的 http 输出.
+func accessLog(context *fargocontext.Context, w *responseWriter) {
+	reqTime := time.Now().Sub(w.start)
+	// 没有任何输出时 net/http 返回 200.
+	status := w.Status()
+	if status == 0 && !w.hijacked {
+		status = http.StatusOK
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "ACCESS_INFO: %s %s %s %s %d %d %s %s", context.Input.IP(), context.Input.URL(), context.Input.Host(),
+		context.Input.Method(), status, w.BytesWritten(), context.Input.Refer(), context.Input.UserAgent())
+	if info, _ := context.Input.Data[accessLogInfoKey].(string); info != "" {
+		fmt.Fprintf(&buf, " %s", info)
+	}
+	accessLogPrintf("%s %s %s", buf.String(), reqTime.String(), w.TimeToFirstByte().String())
+}
+
+// accessLogPrintf 输出 access log, 默认写入 Log, 测试中可以替换以获取输出.
+var accessLogPrintf = func(format string, args ...interface{}) {
+	Log.PrintfN(3, format, args...)
+}
+
+// dispatch 分发请求, 依次处理静态文件, 路由, 过滤函数以及 controller, 被 Use 添加的中间件包裹.
+// Parameters:
+// - context: 上下文.
+func (p *ControllerRegistor) dispatch(context *fargocontext.Context) {
 	var (
 		findrouter bool
 		runMethod  string
 		runrouter  reflect.Type
+		runHandler HandlerFunc
+
+		// 自定义方法的参数名称.
+		actionParams []string
 	)
 
+	// 中间件替换了 ResponseWriter 时重新封装.
+	w, ok := context.ResponseWriter.(*responseWriter)
+	if !ok {
+		w = &responseWriter{writer: context.ResponseWriter, start: time.Now()}
+		context.ResponseWriter = w
+	}
+	rw := w.writer
+	r := context.Request
+
+	// 过滤函数中的 Abort 以及 StopRun, 在这里处理以便中间件正常返回.
+	defer func() {
+		if err := recover(); err != nil && !p.handleAbort(err, w, r) {
+			panic(err)
+		}
+	}()
+
 	// 请求开始时间.
 	requestPath := r.URL.Path
-	beforeRequestTime := time.Now()
+	beforeRequestTime := w.start
 	requestUnix := beforeRequestTime.Unix()
+	urlPath := routerPath(r)
 
-	params := make(map[string]string)
-	w := &responseWriter{writer: rw}
-	w.Header().Set("Server", gServerName)
-
-	// 初始化 context 将 response 和 request 包入 Context 中
-	context := &fargocontext.Context{
-		ResponseWriter: w,
-		Request:        r,
-		Input:          fargocontext.NewInput(r),
-		Output:         fargocontext.NewOutput(),
-	}
-	context.Output.Context = context
-	context.Output.EnableGzip = enableGzip
-
-	var urlPath string
-	if !RouterCaseSensitive {
-		urlPath = strings.ToLower(r.URL.Path)
-	} else {
-		urlPath = r.URL.Path
-	}
-
-	// defined filter function
+	// 全局的过滤函数之后执行绑定到路由上的过滤函数.
+	var routeFilters map[int][]*FilterRouter
 	doFilter := func(pos int) (started bool) {
-		if p.enableFilter {
-			if l, ok := p.filters[pos]; ok {
-				for _, filterR := range l {
-					if ok, p := filterR.ValidRouter(urlPath); ok {
-						context.Input.Params = p
-						filterR.filterFunc(context)
-						if filterR.returnOnOutput && w.started {
-							return true
-						}
-					}
-				}
-			}
-		}
-
-		return false
+		return p.doFilter(pos, context, w, urlPath) || execFilters(routeFilters[pos], pos, context, w, urlPath)
 	}
 
+	// websocket 在请求结束之后仍然使用连接, context 不再被复用.
 	if context.Input.IsWebsocket() {
 		context.ResponseWriter = rw
+		context.Retain()
 	}
 
 	// session init.
@@ -496,7 +1488,7 @@ func (p *ControllerRegistor) ServeHTTP(rw http.ResponseWriter, r *http.Request)
 				}
 				// 如果访问的是文件夹并且设置 directoryIndex 为 false.
 				if finfo.IsDir() && !directoryIndex {
-					middleware.Exception("403", rw, r, "403 Forbidden")
+					middleware.Exception("403", w, r, "403 Forbidden")
 					continue
 				}
 
@@ -506,75 +1498,114 @@ func (p *ControllerRegistor) ServeHTTP(rw http.ResponseWriter, r *http.Request)
 		}
 	}
 
+	// API 版本, 废弃的版本带上 Deprecation header, 在 BEFORE_ROUTER 之前获取以便版本分组的过滤函数使用.
+	version := p.requestVersion(urlPath, context.Input.Header)
+	context.Input.APIVersion = version
+	if p.deprecatedVersions[version] {
+		w.Header().Set("Deprecation", "true")
+	}
+
 	if doFilter(BEFORE_ROUTER) {
 		return
 	}
 
-	// 查找固定路由的路径.
-	for _, route := range p.fixrouters {
-		n := len(requestPath)
-		if requestPath == route.pattern {
-			runMethod = p.getRunMethod(r.Method, context, route)
-			if runMethod != "" {
-				runrouter = route.controllerType
-				findrouter = true
-				break
-			}
+	// 在路由树中查找路由.
+	host := context.Input.Host()
+	httpMethod := p.getHTTPMethod(r.Method, context)
+	route, params := p.findVersionRouter(host, version, httpMethod, urlPath)
+	if route != nil {
+		runMethod = p.getRunMethod(httpMethod, route)
+	}
+	// controller 没有实现 HEAD 时按照 GET 处理, net/http 不会输出 HEAD 请求的 body.
+	if runMethod == "" && httpMethod == "head" {
+		if route, params = p.findVersionRouter(host, version, "get", urlPath); route != nil {
+			runMethod = p.getRunMethod("get", route)
 		}
+	}
+	// 请求超时时间, 路由的超时时间优先于全局的 requesttimeout.
+	timeout := time.Duration(requestTimeout) * time.Millisecond
+	if route != nil && route.timeout > 0 {
+		timeout = route.timeout
+	}
+	if timeout > 0 {
+		ctx, cancel := stdcontext.WithTimeout(context.Context(), timeout)
+		defer cancel()
+		context.SetContext(ctx)
+	}
+
+	// 挂载的 http.Handler 不经过 controller, 请求体在解析表单时已经被读取, 需要重新放回.
+	if runMethod != "" && route.httpHandler != nil {
+		if context.Input.RequestBody != nil {
+			r.Body = ioutil.NopCloser(bytes.NewReader(context.Input.RequestBody))
+		}
+		route.httpHandler.ServeHTTP(w, r.WithContext(context.Context()))
+		return
+	}
+	if runMethod != "" {
 		// 保证模式 /admin  下 url /admin 200 /admin/ 200.
 		// 保证模式 /admin/ 下 url /admin 301 /admin/ 200.
-		if requestPath[n-1] != '/' && requestPath+"/" == route.pattern {
+		n := len(route.pattern)
+		if n > 1 && route.pattern[n-1] == '/' && requestPath[len(requestPath)-1] != '/' {
 			http.Redirect(w, r, requestPath+"/", 301)
-			continue
+			return
 		}
-		if requestPath[n-1] == '/' && route.pattern+"/" == requestPath {
-			runMethod = p.getRunMethod(r.Method, context, route)
-			if runMethod != "" {
-				runrouter = route.controllerType
-				findrouter = true
-				break
+
+		// 转换带类型的参数, 转换失败时返回 400.
+		for key, convert := range route.converters {
+			v, err := convert(params[key])
+			if err != nil {
+				Debugf("convert param %s=%s error: %v", key, params[key], err)
+				middleware.Exception("400", w, r, "400 Bad Request")
+				return
 			}
+			context.Input.SetParamValue(key, v)
 		}
-	}
 
-	// 查找正则路由.
-	if !findrouter {
-		for _, route := range p.routers {
-
-			// 检测正则是否匹配 url.
-			if !route.regex.MatchString(requestPath) {
-				continue
+		if len(params) > 0 {
+			// 在 query 参数 map 中添加 url 参数.
+			values := r.URL.Query()
+			for k, v := range params {
+				values.Add(k, v)
 			}
+			// 重组.
+			r.URL.RawQuery = url.Values(values).Encode()
+			context.Input.Params = params
+		}
+		runrouter = route.controllerType
+		runHandler = route.handler
+		routeFilters = route.filters
 
-			// 双重检测正则是否和 url 模式匹配.
-			matches := route.regex.FindStringSubmatch(requestPath)
-			if len(matches[0]) != len(requestPath) {
-				continue
-			}
+		actionParams = route.actionParams[runMethod]
+		findrouter = true
+	}
 
-			if len(route.params) > 0 {
-				// 在 query 参数 map 中添加 url 参数.
-				values := r.URL.Query()
-				for i, match := range matches[1:] {
-					values.Add(route.params[i], match)
-					params[route.params[i]] = match
-				}
-				// 重组.
-				r.URL.RawQuery = url.Values(values).Encode()
-			}
-			runMethod = p.getRunMethod(r.Method, context, route)
-			if runMethod != "" {
-				runrouter = route.controllerType
-				context.Input.Params = params
-				findrouter = true
-				break
+	// 查找智能路由.
+	if !findrouter && p.enableAuto {
+		if t, m, params := p.findAutoRouter(requestPath); t != nil {
+			runMethod = m
+			runrouter = t
+			context.Input.Params = params
+			findrouter = true
+		}
+	}
+
+	// url 匹配但是方法不匹配时返回 405 并且带上 Allow header, OPTIONS 请求直接返回 Allow.
+	if !findrouter {
+		if allow := p.allowedMethods(host, version, urlPath); len(allow) > 0 {
+			w.Header().Set("Allow", strings.Join(allow, ", "))
+			if httpMethod == "options" {
+				w.Header().Set("Content-Length", "0")
+				w.WriteHeader(http.StatusOK)
+				return
 			}
+			middleware.Exception("405", w, r, "405 Method Not Allowed")
+			return
 		}
 	}
 
 	// 如果路由还没有找到, 抛出 404 页面.
 	if !findrouter {
-		middleware.Exception("404", rw, r, "")
+		middleware.Exception("404", w, r, "")
 		return
 	}
 
@@ -585,16 +1616,31 @@ func (p *ControllerRegistor) ServeHTTP(rw http.ResponseWriter, r *http.Request)
 			return
 		}
 
-		// 调用 handler.
-		c := reflect.New(runrouter)
-		execController, ok := c.Interface().(ControllerInterface)
-		if !ok {
-			Log.Print(fmt.Errorf("controller is not ControllerInterface"))
-			return
+		var (
+			c              reflect.Value
+			execController ControllerInterface
+			controllerName string
+		)
+		if runHandler != nil {
+			// 函数路由不通过反射创建 controller, 使用 fargo.Controller 处理 xsrf 和 access log.
+			hc := acquireHandlerController()
+			defer releaseHandlerController(context, hc)
+			execController = hc
+		} else {
+			// 调用 handler, controller 从 pool 中获取, 请求结束之后清空并放回.
+			c = acquireController(runrouter)
+			ec, ok := c.Interface().(ControllerInterface)
+			if !ok {
+				Log.Print(fmt.Errorf("controller is not ControllerInterface"))
+				return
+			}
+			defer releaseController(context, c)
+			execController = ec
+			controllerName = runrouter.Name()
 		}
 
 		// 执行 controller.Init() 方法, 进行 controller 初始化.
-		execController.Init(context, runrouter.Name(), runMethod, c.Interface())
+		execController.Init(context, controllerName, runMethod, execController)
 
 		// 如果设置了 XSRF, 则 检测 cookie 中 是否有任何 _csrf
 		if enableXSRF {
@@ -604,65 +1650,76 @@ func (p *ControllerRegistor) ServeHTTP(rw http.ResponseWriter, r *http.Request)
 			}
 		}
 
-		// 执行 prepare funtion
-		execController.Prepare()
-
-		// 执行 filter 函数
-		if !execController.Filter() {
-			afterRequestTime := time.Now()
-			requestTime := afterRequestTime.Sub(beforeRequestTime)
-			execController.accessLog(requestTime, requestUnix)
-			execController.Finish()
-			return
-		}
+		// Prepare, Filter 以及执行主体, Abort 以及 StopRun 只中止这一部分, Finish 和 AFTER_EXEC 仍然执行.
+		var filtered bool
+		p.abortable(w, r, func() {
+			// 执行 prepare funtion
+			execController.Prepare()
 
-		// 执行主体
-		if !w.started {
-			switch runMethod {
-			case "Get":
-				execController.Get()
-			case "Post":
-				execController.Post()
-			case "Delete":
-				execController.Delete()
-			case "Put":
-				execController.Put()
-			case "Head":
-				execController.Head()
-			case "Patch":
-				execController.Patch()
-			case "Options":
-				execController.Options()
-			default:
-				var in = make([]reflect.Value, 0)
-				method := c.MethodByName(runMethod)
-				method.Call(in)
+			// 执行 filter 函数
+			if !execController.Filter() {
+				filtered = true
+				return
 			}
 
-			// 请求使用时间以及当前请求时间戳, 并记录 access log.
-			if enableAccessLog {
-				afterRequestTime := time.Now()
-				requestTime := afterRequestTime.Sub(beforeRequestTime)
-				execController.accessLog(requestTime, requestUnix)
-			}
+			// 执行主体
+			if !w.started && runHandler != nil {
+				runHandler(context)
+			} else if !w.started {
+				switch runMethod {
+				case "Get":
+					execController.Get()
+				case "Post":
+					execController.Post()
+				case "Delete":
+					execController.Delete()
+				case "Put":
+					execController.Put()
+				case "Head":
+					execController.Head()
+				case "Patch":
+					execController.Patch()
+				case "Options":
+					execController.Options()
+				default:
+					// 带参数或者返回值的方法自动绑定参数并输出返回值.
+					method := c.MethodByName(runMethod)
+					if t := method.Type(); t.NumIn() > 0 || t.NumOut() > 0 {
+						callAction(context, execController, method, actionParams)
+					} else {
+						method.Call(nil)
+					}
+				}
+
+				// 请求使用时间以及当前请求时间戳, 供模板使用.
+				if enableAccessLog {
+					context.Input.Data["fargo_req_time"] = time.Now().Sub(beforeRequestTime).String()
+					context.Input.Data["fargo_req_now"] = requestUnix
+				}
 
-			// 渲染模板
-			if !w.started && !context.Input.IsWebsocket() {
-				if autoRender {
-					if err := execController.Render(); err != nil {
-						Error(err)
-						return
+				// 渲染模板
+				if !w.started && !context.Input.IsWebsocket() {
+					if autoRender {
+						if err := execController.Render(); err != nil {
+							Error(err)
+						}
 					}
 				}
 			}
-		}
+		})
 
 		// 完成，释放资源
 		execController.Finish()
 
-		// execute 之后的 filter.
-		if doFilter(AFTER_EXEC) {
+		// Controller.Accesslog 在请求结束时和 access log 一起输出.
+		if info := execController.accessLogInfo(); info != "" {
+			context.Input.Data[accessLogInfoKey] = info
+		}
+		if filtered {
 			return
 		}
+
+		// execute 之后的 filter, controller 已经输出时仍然执行.
+		doFilter(AFTER_EXEC)
 	}
 }
@@ -0,0 +1,1292 @@
+package fargo
+
+import (
+	"fargo/context"
+	"fargo/middleware"
+	"fargo/session"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testConfigName 测试使用的配置文件.
+var testConfigName = setupTestConfig()
+
+// setupTestConfig 注册 go test 的参数并在临时目录中写入测试使用的配置文件, 日志也写入临时目录.
+// 包级变量在所有 init 之前初始化, 因此 init 中的 flag.Parse 可以解析 go test 的参数并读取这个配置文件.
+func setupTestConfig() string {
+	testing.Init()
+	name := filepath.Join(os.TempDir(), "fargo_test.conf")
+	conf := fmt.Sprintf("[web]\nappname = fargo\npath = %s\nprefix = fargo_test\nenablestatic = false\n", os.TempDir())
+	if err := ioutil.WriteFile(name, []byte(conf), 0644); err != nil {
+		panic(err)
+	}
+	*gConfigName = name
+	return name
+}
+
+type testController struct {
+	Controller
+}
+
+func (c *testController) List() {}
+
+type testOtherController struct {
+	Controller
+}
+
+func TestRouterMatch(t *testing.T) {
+	p := NewControllerRegistor()
+	p.Add("/", &testController{})
+	p.Add("/user", &testController{})
+	p.Add("/user/profile", &testOtherController{})
+	p.Add("/user/:id:int", &testController{})
+	p.Add("/user/:name:string", &testOtherController{})
+	p.Add("/user/*", &testController{})
+	p.Add("/file/*.*", &testController{})
+	p.Add("/static/*", &testController{})
+	p.Add("/post/:id([0-9]+)/:page", &testController{})
+	p.Add("/api/list", &testController{}, "get:List")
+
+	cases := []struct {
+		method string
+		path   string
+		ok     bool
+		ctype  string
+		params map[string]string
+	}{
+		{"get", "/", true, "testController", nil},
+		{"get", "/user", true, "testController", nil},
+		{"get", "/user/", true, "testController", nil},
+		{"get", "/user/profile", true, "testOtherController", nil},
+		{"get", "/user/123", true, "testController", map[string]string{":id": "123"}},
+		{"get", "/user/astaxie", true, "testOtherController", map[string]string{":name": "astaxie"}},
+		{"get", "/user/a-b", true, "testController", map[string]string{":splat": "a-b"}},
+		{"get", "/file/a/b/c.png", true, "testController", map[string]string{":path": "a/b/c", ":ext": "png"}},
+		{"get", "/static/js/jquery.js", true, "testController", map[string]string{":splat": "js/jquery.js"}},
+		{"get", "/post/12/3", true, "testController", map[string]string{":id": "12", ":page": "3"}},
+		{"get", "/api/list", true, "testController", nil},
+		{"post", "/api/list", false, "", nil},
+		{"get", "/none", false, "", nil},
+	}
+	for _, c := range cases {
+		route, params := p.findRouter("", c.method, c.path)
+		if (route != nil) != c.ok {
+			t.Errorf("%s %s: expect found %v, got %v", c.method, c.path, c.ok, route != nil)
+			continue
+		}
+		if route == nil {
+			continue
+		}
+		if route.controllerType.Name() != c.ctype {
+			t.Errorf("%s %s: expect controller %s, got %s", c.method, c.path, c.ctype, route.controllerType.Name())
+		}
+		for k, v := range c.params {
+			if params[k] != v {
+				t.Errorf("%s %s: expect param %s=%s, got %s", c.method, c.path, k, v, params[k])
+			}
+		}
+	}
+}
+
+func BenchmarkRouterMatch(b *testing.B) {
+	for _, n := range []int{10, 100, 1000} {
+		p := NewControllerRegistor()
+		for i := 0; i < n; i++ {
+			p.Add(fmt.Sprintf("/api/v1/res%d", i), &testController{})
+			p.Add(fmt.Sprintf("/api/v1/res%d/:id:int", i), &testController{})
+		}
+		last := fmt.Sprintf("/api/v1/res%d/12345", n-1)
+		b.Run(fmt.Sprintf("routes=%d", 2*n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if route, _ := p.findRouter("", "get", last); route == nil {
+					b.Fatal("route not found")
+				}
+			}
+		})
+	}
+}
+
+func TestNamespace(t *testing.T) {
+	p := NewControllerRegistor()
+	noop := func(*context.Context) {}
+	api := p.Namespace("/api/v1/").Filter(BEFORE_ROUTER, noop)
+	api.Add("/user/:id:int", &testController{})
+	api.Namespace("admin").Filter(BEFORE_EXEC, noop).Add("/", &testOtherController{})
+
+	if route, params := p.findRouter("", "get", "/api/v1/user/7"); route == nil || params[":id"] != "7" {
+		t.Fatalf("expect /api/v1/user/7 matched, got %v %v", route, params)
+	}
+	if route, _ := p.findRouter("", "get", "/api/v1/admin"); route == nil || route.controllerType.Name() != "testOtherController" {
+		t.Fatalf("expect /api/v1/admin matched, got %v", route)
+	}
+	for _, u := range []string{"/api/v1", "/api/v1/user/7", "/api/v1/admin"} {
+		if ok, _ := p.filters[BEFORE_ROUTER][0].ValidRouter(u); !ok {
+			t.Errorf("expect group filter matched %s", u)
+		}
+	}
+	if ok, _ := p.filters[BEFORE_ROUTER][0].ValidRouter("/api/v2/user"); ok {
+		t.Error("expect group filter not matched /api/v2/user")
+	}
+	if ok, _ := p.filters[BEFORE_EXEC][0].ValidRouter("/api/v1/user/7"); ok {
+		t.Error("expect sub group filter not matched /api/v1/user/7")
+	}
+}
+
+func TestURLFor(t *testing.T) {
+	p := NewControllerRegistor()
+	p.Add("/user/:id:int", &testController{}, "get:List")
+	p.AddNamed("post", "/post/:id([0-9]+)_:name/:page:string", &testOtherController{})
+	p.AddNamed("file", "/file/*.*", &testOtherController{})
+	p.AddNamed("static", "/static/*", &testOtherController{})
+	p.AddNamed("profile", "/profile/?:id", &testOtherController{})
+	p.AddNamed("home", "/?:lang", &testOtherController{})
+
+	cases := []struct {
+		endpoint string
+		values   []interface{}
+		expect   string
+	}{
+		{"testController.List", []interface{}{":id", 12, "q", "a b"}, "/user/12?q=a+b"},
+		{"post", []interface{}{"id", 1, ":name", "go", ":page", "p2"}, "/post/1_go/p2"},
+		{"testOtherController.Get", []interface{}{"id", 1, ":name", "go", ":page", "p2"}, "/post/1_go/p2"},
+		{"file", []interface{}{":path", "a/b", ":ext", "png"}, "/file/a/b.png"},
+		{"static", []interface{}{":splat", "js/app.js"}, "/static/js/app.js"},
+		{"profile", []interface{}{"id", 3}, "/profile/3"},
+		{"profile", []interface{}{"tab", "info"}, "/profile?tab=info"},
+		{"home", nil, "/"},
+		{"testController.List", nil, ""},
+		{"none", nil, ""},
+	}
+	for _, c := range cases {
+		if u := p.URLFor(c.endpoint, c.values...); u != c.expect {
+			t.Errorf("URLFor(%s, %v): expect %s, got %s", c.endpoint, c.values, c.expect, u)
+		}
+	}
+}
+
+func TestAutoRouter(t *testing.T) {
+	p := NewControllerRegistor()
+	p.AddAuto(&testController{})
+
+	ct, m, params := p.findAutoRouter("/Test/LIST/12/abc")
+	if ct == nil || m != "List" || params["0"] != "12" || params["1"] != "abc" {
+		t.Fatalf("expect /test/list matched, got %v %s %v", ct, m, params)
+	}
+	for _, u := range []string{"/test/init", "/test/getstring", "/test/render", "/test/stoprun", "/test/abort", "/test/none", "/other/list"} {
+		if ct, _, _ := p.findAutoRouter(u); ct != nil {
+			t.Errorf("expect %s not matched", u)
+		}
+	}
+	if u := p.URLFor("testController.List", "page", 1); u != "/test/list?page=1" {
+		t.Errorf("expect /test/list?page=1, got %s", u)
+	}
+}
+
+func TestHostRouter(t *testing.T) {
+	p := NewControllerRegistor()
+	p.Add("/", &testController{})
+	p.AddHost("admin.example.com", "/", &testOtherController{})
+	p.Namespace("/api").Host(":tenant.example.com").Add("/user", &testOtherController{})
+
+	cases := []struct {
+		host   string
+		path   string
+		ctype  string
+		tenant string
+	}{
+		{"admin.example.com", "/", "testOtherController", ""},
+		{"ADMIN.example.com", "/", "testOtherController", ""},
+		{"www.example.com", "/", "testController", ""},
+		{"acme.example.com", "/api/user", "testOtherController", "acme"},
+		{"", "/", "testController", ""},
+	}
+	for _, c := range cases {
+		route, params := p.findRouter(c.host, "get", c.path)
+		if route == nil || route.controllerType.Name() != c.ctype {
+			t.Errorf("%s%s: expect %s, got %v", c.host, c.path, c.ctype, route)
+			continue
+		}
+		if params[":tenant"] != c.tenant {
+			t.Errorf("%s%s: expect tenant %s, got %s", c.host, c.path, c.tenant, params[":tenant"])
+		}
+	}
+	if route, _ := p.findRouter("www.other.com", "get", "/api/user"); route != nil {
+		t.Error("expect /api/user not matched on www.other.com")
+	}
+}
+
+type testGetController struct {
+	Controller
+}
+
+func (c *testGetController) Get() {
+	c.Ctx.WriteString("get")
+}
+
+func (c *testGetController) Create() {
+	c.Ctx.WriteString("create")
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	p := NewControllerRegistor()
+	p.Add("/user", &testGetController{})
+	p.Add("/api/create", &testGetController{}, "post,put:Create")
+
+	cases := []struct {
+		method string
+		path   string
+		code   int
+		allow  string
+	}{
+		{"GET", "/user", 200, ""},
+		{"HEAD", "/user", 200, ""},
+		{"POST", "/user", 405, "GET, HEAD, OPTIONS"},
+		{"OPTIONS", "/user", 200, "GET, HEAD, OPTIONS"},
+		{"GET", "/api/create", 405, "POST, PUT, OPTIONS"},
+		{"PUT", "/api/create", 200, ""},
+		{"GET", "/none", 404, ""},
+	}
+	for _, c := range cases {
+		rw := httptest.NewRecorder()
+		p.ServeHTTP(rw, httptest.NewRequest(c.method, c.path, nil))
+		if rw.Code != c.code {
+			t.Errorf("%s %s: expect status %d, got %d", c.method, c.path, c.code, rw.Code)
+		}
+		if allow := rw.Header().Get("Allow"); allow != c.allow {
+			t.Errorf("%s %s: expect Allow %q, got %q", c.method, c.path, c.allow, allow)
+		}
+	}
+}
+
+func TestFuncRouter(t *testing.T) {
+	p := NewControllerRegistor()
+	p.AddFunc("get", "/ping/:id:int", func(ctx *context.Context) {
+		ctx.WriteString("pong " + ctx.Input.Param(":id"))
+	})
+	p.Namespace("/api").AddFunc("*", "/any", func(ctx *context.Context) {
+		ctx.WriteString(ctx.Input.Method())
+	})
+	var filtered bool
+	p.InsertFilter("/ping/*", BEFORE_EXEC, func(ctx *context.Context) { filtered = true })
+
+	cases := []struct {
+		method string
+		path   string
+		code   int
+		body   string
+	}{
+		{"GET", "/ping/1", 200, "pong 1"},
+		{"POST", "/ping/1", 405, "405 Method Not Allowed\n"},
+		{"DELETE", "/api/any", 200, "DELETE"},
+	}
+	for _, c := range cases {
+		rw := httptest.NewRecorder()
+		p.ServeHTTP(rw, httptest.NewRequest(c.method, c.path, nil))
+		if rw.Code != c.code || rw.Body.String() != c.body {
+			t.Errorf("%s %s: expect %d %q, got %d %q", c.method, c.path, c.code, c.body, rw.Code, rw.Body.String())
+		}
+	}
+	if !filtered {
+		t.Error("expect filter executed before function router")
+	}
+}
+
+func TestMountHandler(t *testing.T) {
+	p := NewControllerRegistor()
+	p.Handler("/mount/", http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		fmt.Fprintf(rw, "%s %s %s", r.Method, r.URL.Path, body)
+	}), true)
+	var filtered bool
+	p.InsertFilter("/mount/*", BEFORE_ROUTER, func(ctx *context.Context) { filtered = true })
+
+	rw := httptest.NewRecorder()
+	p.ServeHTTP(rw, httptest.NewRequest("POST", "/mount/a/b?x=1", strings.NewReader("k=v")))
+	if rw.Code != 200 || rw.Body.String() != "POST /a/b k=v" {
+		t.Errorf("expect 200 %q, got %d %q", "POST /a/b k=v", rw.Code, rw.Body.String())
+	}
+	if !filtered {
+		t.Error("expect BEFORE_ROUTER filter executed before mounted handler")
+	}
+}
+
+func TestRouteConflict(t *testing.T) {
+	p := NewControllerRegistor()
+	p.Add("/user/:id", &testController{})
+	p.Add("/user/:name", &testOtherController{})
+	p.Add("/post/:id(.+)", &testController{})
+	p.Add("/post/:id([0-9]+)", &testController{})
+	p.Add("/bad/:id([0-9]+", &testController{})
+	p.Add("/api/list", &testController{}, "get:List")
+	p.Add("/api/list", &testOtherController{}, "post:Post")
+
+	errs := p.RouteErrors()
+	if len(errs) != 3 {
+		t.Fatalf("expect 3 route errors, got %v", errs)
+	}
+	for i, s := range []string{"duplicate route /user/:name", "route /post/:id([0-9]+) is shadowed", "invalid route pattern /bad/"} {
+		if !strings.Contains(errs[i].Error(), s) {
+			t.Errorf("expect error %q, got %q", s, errs[i])
+		}
+	}
+	if route, _ := p.findRouter("", "get", "/user/1"); route == nil || route.controllerType.Name() != "testController" {
+		t.Errorf("expect duplicate route dropped, got %v", route)
+	}
+
+	p.InsertFilter("/api/*", BEFORE_ROUTER, func(ctx *context.Context) {})
+	routes := p.Routes()
+	if len(routes) != 5 {
+		t.Fatalf("expect 5 routes, got %v", routes)
+	}
+	if r := routes[4]; r.Pattern != "/api/list" || r.Methods["POST"] != "Post" || r.Controller != "fargo.testOtherController" || len(r.Filters) != 1 {
+		t.Errorf("unexpected route info %+v", r)
+	}
+
+	// 重复的路由名称以及过滤函数名称.
+	p.AddNamed("list", "/named/a", &testController{})
+	p.AddNamed("list", "/named/b", &testOtherController{})
+	p.InsertNamedFilter("auth", "/*", BEFORE_EXEC, 0, func(ctx *context.Context) {})
+	p.InsertNamedFilter("auth", "/*", BEFORE_EXEC, 0, func(ctx *context.Context) {})
+	errs = p.RouteErrors()
+	if len(errs) != 5 {
+		t.Fatalf("expect 5 route errors, got %v", errs)
+	}
+	for i, s := range []string{"route name list already exists, ignored for /named/b", "filter name auth already exists"} {
+		if errs[3+i].Error() != s {
+			t.Errorf("expect error %q, got %q", s, errs[3+i])
+		}
+	}
+	if u := p.URLFor("list"); u != "/named/a" {
+		t.Errorf("expect first named route kept, got %s", u)
+	}
+}
+
+func TestParamType(t *testing.T) {
+	if err := AddParamType("upper", "([A-Z]+)", nil); err == nil {
+		t.Error("expect error for capturing group")
+	}
+	if err := AddParamType("upper", "[A-Z]+", func(v string) (interface{}, error) { return []rune(v), nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewControllerRegistor()
+	value := func(ctx *context.Context) {
+		ctx.WriteString(fmt.Sprintf("%T", ctx.Input.ParamValue(":v")))
+	}
+	p.AddFunc("get", "/int64/:v:int64", value)
+	p.AddFunc("get", "/int/:v:int", value)
+	p.AddFunc("get", "/uuid/:v:uuid", value)
+	p.AddFunc("get", "/date/:v:date", value)
+	p.AddFunc("get", "/hex/:v:hex", value)
+	p.AddFunc("get", "/slug/:v:slug", func(ctx *context.Context) { ctx.WriteString(ctx.Input.Param(":v")) })
+	p.AddFunc("get", "/upper/:v:upper", value)
+
+	cases := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/int64/-42", 200, "int64"},
+		{"/int64/99999999999999999999", 400, "400 Bad Request\n"},
+		{"/int/42", 200, "int"},
+		{"/uuid/6BA7B810-9DAD-11D1-80B4-00C04FD430C8", 200, "string"},
+		{"/uuid/123", 404, "404 page not found\n"},
+		{"/date/2020-02-29", 200, "time.Time"},
+		{"/date/2021-02-29", 400, "400 Bad Request\n"},
+		{"/hex/0aff", 200, "[]uint8"},
+		{"/hex/abc", 400, "400 Bad Request\n"},
+		{"/slug/hello-world-2", 200, "hello-world-2"},
+		{"/slug/Hello", 404, "404 page not found\n"},
+		{"/upper/ABC", 200, "[]int32"},
+	}
+	for _, c := range cases {
+		rw := httptest.NewRecorder()
+		p.ServeHTTP(rw, httptest.NewRequest("GET", c.path, nil))
+		if rw.Code != c.code || rw.Body.String() != c.body {
+			t.Errorf("%s: expect %d %q, got %d %q", c.path, c.code, c.body, rw.Code, rw.Body.String())
+		}
+	}
+	if u, _, _ := buildURL("/date/:v:date/:id:int64", map[string]string{"v": "2020-01-02", "id": "7"}); u != "/date/2020-01-02/7" {
+		t.Errorf("expect /date/2020-01-02/7, got %s", u)
+	}
+
+	// 类型名称必须完整匹配, 不能按照前缀匹配已有的类型.
+	p.AddFunc("get", "/integer/:v:integer", value)
+	p.AddFunc("get", "/dates/:v:dates", value)
+	errs := p.RouteErrors()
+	if len(errs) != 2 {
+		t.Fatalf("expect 2 route errors, got %v", errs)
+	}
+	for i, s := range []string{"unknown param type integer", "unknown param type dates"} {
+		if !strings.Contains(errs[i].Error(), s) {
+			t.Errorf("expect error %q, got %q", s, errs[i])
+		}
+	}
+
+	// 大小写不敏感时参数名称被转换为小写, 转换函数仍然生效.
+	RouterCaseSensitive = false
+	defer func() { RouterCaseSensitive = true }()
+	p = NewControllerRegistor()
+	p.AddFunc("get", "/user/:userId:int", func(ctx *context.Context) {
+		ctx.WriteString(fmt.Sprintf("%T", ctx.Input.ParamValue(":userid")))
+	})
+	rw := httptest.NewRecorder()
+	p.ServeHTTP(rw, httptest.NewRequest("GET", "/user/42", nil))
+	if rw.Body.String() != "int" {
+		t.Errorf("expect int, got %q", rw.Body.String())
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	p := NewControllerRegistor()
+	var trace []string
+	for _, name := range []string{"outer", "inner"} {
+		name := name
+		p.Use(func(next HandlerFunc) HandlerFunc {
+			return func(ctx *context.Context) {
+				trace = append(trace, name+">")
+				next(ctx)
+				trace = append(trace, "<"+name)
+			}
+		})
+	}
+	p.AddFunc("get", "/ok", func(ctx *context.Context) { ctx.WriteString("ok") })
+	p.AddFunc("get", "/panic", func(ctx *context.Context) { panic("boom") })
+	for _, pos := range []int{AFTER_EXEC, FINISH_ROUTER} {
+		pos := pos
+		for i := 0; i < 2; i++ {
+			p.InsertFilter("/*", pos, func(ctx *context.Context) { trace = append(trace, filterPosNames[pos]) })
+		}
+	}
+
+	cases := []struct {
+		path  string
+		trace string
+	}{
+		{"/ok", "outer> inner> AFTER_EXEC AFTER_EXEC <inner <outer FINISH_ROUTER FINISH_ROUTER"},
+		{"/none", "outer> inner> <inner <outer FINISH_ROUTER FINISH_ROUTER"},
+		{"/panic", "outer> inner> FINISH_ROUTER FINISH_ROUTER"},
+	}
+	for _, c := range cases {
+		trace = nil
+		p.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", c.path, nil))
+		if s := strings.Join(trace, " "); s != c.trace {
+			t.Errorf("%s: expect trace %q, got %q", c.path, c.trace, s)
+		}
+	}
+}
+
+func TestFilterOrder(t *testing.T) {
+	p := NewControllerRegistor()
+	var trace []string
+	filter := func(name string) FilterFunc {
+		return func(ctx *context.Context) { trace = append(trace, name) }
+	}
+	p.AddFunc("get", "/admin/:id", func(ctx *context.Context) { ctx.WriteString("ok") }).
+		Filter(BEFORE_EXEC, filter("route")).
+		Filter(AFTER_EXEC, filter("route-after"))
+	p.AddFunc("get", "/public", func(ctx *context.Context) { ctx.WriteString("ok") })
+	p.InsertFilter("/*", BEFORE_EXEC, filter("default"))
+	p.InsertNamedFilter("auth", "/admin/*", BEFORE_EXEC, -10, func(ctx *context.Context) {
+		trace = append(trace, "auth")
+		ctx.Output.SetStatus(401)
+	})
+	p.InsertNamedFilter("log", "/*", BEFORE_EXEC, 10, filter("log"))
+	if err := p.InsertNamedFilter("auth", "/*", BEFORE_EXEC, 0, filter("dup")); err == nil {
+		t.Error("expect error for duplicate filter name")
+	}
+
+	serve := func(path string) (int, string) {
+		trace = nil
+		rw := httptest.NewRecorder()
+		p.ServeHTTP(rw, httptest.NewRequest("GET", path, nil))
+		return rw.Code, strings.Join(trace, " ")
+	}
+	if code, s := serve("/admin/1"); code != 401 || s != "auth" {
+		t.Errorf("expect 401 auth, got %d %q", code, s)
+	}
+	if !p.ReplaceFilter("auth", filter("fake-auth")) {
+		t.Fatal("expect auth filter replaced")
+	}
+	if code, s := serve("/admin/1"); code != 200 || s != "fake-auth default log route route-after" {
+		t.Errorf("expect 200 with all filters, got %d %q", code, s)
+	}
+	if !p.RemoveFilter("auth") || p.RemoveFilter("auth") {
+		t.Fatal("expect auth filter removed once")
+	}
+	if code, s := serve("/public"); code != 200 || s != "default log" {
+		t.Errorf("expect route filters not applied to /public, got %d %q", code, s)
+	}
+}
+
+// testHostAuth 绑定到域名分组上的过滤函数, 具名函数才能按名称替换.
+func testHostAuth(ctx *context.Context) {
+	ctx.Output.SetStatus(401)
+}
+
+func TestReplaceHostFilter(t *testing.T) {
+	p := NewControllerRegistor()
+	p.AddFunc("get", "/admin/user", func(ctx *context.Context) { ctx.WriteString("ok") })
+	p.Namespace("/admin").Host("admin.example.com").Filter(BEFORE_EXEC, testHostAuth)
+	p.InsertFilter("/*", BEFORE_EXEC, func(ctx *context.Context) {})
+
+	var hosts []string
+	if !p.ReplaceFilter(funcName(testHostAuth), func(ctx *context.Context) {
+		hosts = append(hosts, ctx.Input.Host())
+	}) {
+		t.Fatal("expect host filter replaced")
+	}
+	if p.ReplaceFilter("", testHostAuth) || p.RemoveFilter("") {
+		t.Error("expect anonymous filters not replaced or removed")
+	}
+	for _, host := range []string{"admin.example.com", "www.example.com"} {
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/admin/user", nil)
+		req.Host = host
+		p.ServeHTTP(rw, req)
+		if rw.Code != 200 {
+			t.Errorf("%s: expect 200, got %d", host, rw.Code)
+		}
+	}
+	if len(hosts) != 1 || hosts[0] != "admin.example.com" {
+		t.Errorf("expect replaced filter only run on admin.example.com, got %v", hosts)
+	}
+}
+
+func TestVersionRouter(t *testing.T) {
+	p := NewControllerRegistor()
+	version := func(name string) HandlerFunc {
+		return func(ctx *context.Context) { ctx.WriteString(name + " " + ctx.Input.Version()) }
+	}
+	p.AddFunc("get", "/user", version("v0"))
+	p.AddFunc("get", "/v1/user", version("v1"))
+	p.Namespace("/").Version("2").AddFunc("get", "/user", version("v2"))
+	p.AddFunc("get", "/other", version("other"))
+	p.SetDefaultVersion("v1")
+	p.DeprecateVersion("v1")
+
+	cases := []struct {
+		path       string
+		header     string
+		value      string
+		body       string
+		deprecated bool
+	}{
+		{"/user", "", "", "v1 v1", true},
+		{"/v2/user", "", "", "v2 v2", false},
+		{"/user", "X-API-Version", "2", "v2 v2", false},
+		{"/user", "Accept", "application/vnd.app.v2+json", "v2 v2", false},
+		{"/user", "X-API-Version", "3", "v0 v3", false},
+		{"/v2/other", "", "", "other v2", false},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", c.path, nil)
+		if c.header != "" {
+			r.Header.Set(c.header, c.value)
+		}
+		rw := httptest.NewRecorder()
+		p.ServeHTTP(rw, r)
+		if rw.Body.String() != c.body || (rw.Header().Get("Deprecation") == "true") != c.deprecated {
+			t.Errorf("%s %s=%s: expect %q deprecated %v, got %q %q", c.path, c.header, c.value,
+				c.body, c.deprecated, rw.Body.String(), rw.Header().Get("Deprecation"))
+		}
+	}
+}
+
+func TestNamespaceVersion(t *testing.T) {
+	p := NewControllerRegistor()
+	mark := func(name string) FilterFunc {
+		return func(ctx *context.Context) { ctx.Output.Header("X-"+name, "1") }
+	}
+	api := p.Namespace("/api").Filter(BEFORE_EXEC, mark("Group"))
+	v2 := api.Version("v2").Filter(BEFORE_ROUTER, mark("Version"))
+	v2.AddFunc("get", "/user", func(ctx *context.Context) { ctx.WriteString("v2") })
+	api.AddFunc("get", "/user", func(ctx *context.Context) { ctx.WriteString("v1") }).Filter(BEFORE_EXEC, mark("Route"))
+	if api.Prefix() != "/api" || v2.Prefix() != "/v2/api" {
+		t.Errorf("expect Version not to change the group prefix, got %s %s", api.Prefix(), v2.Prefix())
+	}
+
+	// 版本分组的过滤函数按照请求的版本执行, 包括通过 header 指定的版本.
+	for _, c := range []struct {
+		path    string
+		version string
+		body    string
+		route   string
+		filter  string
+	}{
+		{"/v2/api/user", "", "v2", "", "1"},
+		{"/api/user", "2", "v2", "", "1"},
+		{"/api/user", "", "v1", "1", ""},
+	} {
+		r := httptest.NewRequest("GET", c.path, nil)
+		if c.version != "" {
+			r.Header.Set("X-API-Version", c.version)
+		}
+		rw := httptest.NewRecorder()
+		p.ServeHTTP(rw, r)
+		if rw.Body.String() != c.body || rw.Header().Get("X-Group") != "1" || rw.Header().Get("X-Route") != c.route ||
+			rw.Header().Get("X-Version") != c.filter {
+			t.Errorf("%s version %q: expect %q with group filter, route filter %q and version filter %q, got %q %v",
+				c.path, c.version, c.body, c.route, c.filter, rw.Body.String(), rw.Header())
+		}
+	}
+}
+
+type testBindForm struct {
+	ID      int64     `param:"id"`
+	Name    string    `json:"name"`
+	Age     int       `json:"age"`
+	Tags    []string  `form:"tag"`
+	Page    *int      `form:"page"`
+	Sort    *[]string `form:"sort"`
+	Skip    string    `form:"-"`
+	Address struct {
+		City string `form:"city"`
+	} `form:"address"`
+}
+
+type testBindController struct {
+	Controller
+}
+
+func (c *testBindController) Post() {
+	var f testBindForm
+	err := c.Bind(&f)
+	page := 0
+	if f.Page != nil {
+		page = *f.Page
+	}
+	var sort []string
+	if f.Sort != nil {
+		sort = *f.Sort
+	}
+	c.Ctx.WriteString(fmt.Sprintf("%d %s %d %v %d %v %q %s %v", f.ID, f.Name, f.Age, f.Tags, page, sort, f.Skip, f.Address.City, err))
+}
+
+func TestBind(t *testing.T) {
+	p := NewControllerRegistor()
+	p.Add("/user/:id", &testBindController{})
+
+	cases := []struct {
+		url   string
+		ctype string
+		body  string
+		out   string
+	}{
+		{"/user/7?tag=a&tag=b&page=2&sort=age&sort=-id&Skip=x&address.city=sz", "application/json", `{"name":"bob","age":3}`,
+			`7 bob 3 [a b] 2 [age -id] "" sz <nil>`},
+		{"/user/7", "application/x-www-form-urlencoded", "name=amy&age=4&sort=name", `7 amy 4 [] 0 [name] ""  <nil>`},
+		{"/user/7?page=x", "application/json", `{"age":"3"}`,
+			`7  0 [] 0 [] ""  bind age from age="string": json: cannot unmarshal string into Go struct field testBindForm.age of type int; ` +
+				`bind Page from page="x": strconv.ParseInt: parsing "x": invalid syntax`},
+		{"/user/7", "application/json", `{"name":1,"tag":"x","age":"3"}`,
+			`7  0 [] 0 [] ""  bind name from name="number": json: cannot unmarshal number into Go struct field testBindForm.name of type string; ` +
+				`bind age from age="string": json: cannot unmarshal string into Go struct field testBindForm.age of type int`},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("POST", c.url, strings.NewReader(c.body))
+		r.Header.Set("Content-Type", c.ctype)
+		rw := httptest.NewRecorder()
+		p.ServeHTTP(rw, r)
+		if rw.Body.String() != c.out {
+			t.Errorf("%s %s: expect %q, got %q", c.url, c.body, c.out, rw.Body.String())
+		}
+	}
+}
+
+type testValidForm struct {
+	Name  string `form:"name" valid:"required;maxlen(5)"`
+	Age   int    `json:"age" valid:"range(1,100)"`
+	Code  string `form:"code" valid:"match(/^[a-z;]+$/)"`
+	Inner struct {
+		City string `form:"city" valid:"required"`
+	} `form:"inner"`
+}
+
+type testValidController struct {
+	Controller
+}
+
+func (c *testValidController) Post() {
+	var f testValidForm
+	if c.Bind(&f) == nil && c.Validate(&f) {
+		c.Ctx.WriteString("ok")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	mode := runMode
+	runMode = "api"
+	defer func() { runMode = mode }()
+
+	p := NewControllerRegistor()
+	p.Add("/user", &testValidController{})
+	for body, out := range map[string]string{
+		"name=bob&age=18&inner.city=sz&code=x": "ok",
+		"age=18&inner.city=sz&code=x":          `{"errors":[{"field":"name","rule":"required","message":"name is required"}]}`,
+	} {
+		r := httptest.NewRequest("POST", "/user", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rw := httptest.NewRecorder()
+		p.ServeHTTP(rw, r)
+		if rw.Body.String() != out || out != "ok" && rw.Code != 400 {
+			t.Errorf("%s: expect %q, got %d %q", body, out, rw.Code, rw.Body.String())
+		}
+	}
+}
+
+type testServeController struct {
+	Controller
+}
+
+func (c *testServeController) Post() {
+	c.Serve(201, map[string]interface{}{"id": 1, "name": "bob", "tags": []string{"a", "b: c"}})
+}
+
+func TestServe(t *testing.T) {
+	mode := runMode
+	runMode = "api"
+	defer func() { runMode = mode }()
+
+	p := NewControllerRegistor()
+	p.Add("/user", &testServeController{})
+	p.AddFunc("get", "/status", func(ctx *context.Context) {
+		ctx.Output.Serve(202, "json", "ok", false)
+	})
+
+	cases := []struct {
+		url    string
+		accept string
+		code   int
+		ctype  string
+		body   string
+	}{
+		{"/user", "", 201, "application/json", `{"id":1,"name":"bob","tags":["a","b: c"]}`},
+		{"/user", "application/xml;q=0.9, application/x-yaml", 201, "application/x-yaml",
+			"id: 1\nname: bob\ntags:\n  - a\n  - \"b: c\"\n"},
+		{"/user", "text/html, application/vnd.app.v2+json;q=0.5", 201, "application/json", `{"id":1,"name":"bob","tags":["a","b: c"]}`},
+		{"/user?callback=cb", "", 201, "application/javascript", ` cb({"id":1,"name":"bob","tags":["a","b: c"]});` + "\r\n"},
+		{"/status", "", 202, "application/json", `"ok"`},
+	}
+	for _, c := range cases {
+		method := "POST"
+		if c.url == "/status" {
+			method = "GET"
+		}
+		r := httptest.NewRequest(method, c.url, nil)
+		if c.accept != "" {
+			r.Header.Set("Accept", c.accept)
+		}
+		rw := httptest.NewRecorder()
+		p.ServeHTTP(rw, r)
+		if rw.Code != c.code || !strings.HasPrefix(rw.Header().Get("Content-Type"), c.ctype) || rw.Body.String() != c.body {
+			t.Errorf("%s %s: expect %d %s %q, got %d %s %q", c.url, c.accept, c.code, c.ctype, c.body,
+				rw.Code, rw.Header().Get("Content-Type"), rw.Body.String())
+		}
+	}
+}
+
+var testAbortTrace []string
+
+type testAbortController struct {
+	Controller
+}
+
+func (c *testAbortController) Get() {
+	switch c.GetString("do") {
+	case "abort":
+		c.Abort(403, "nope")
+	case "stop":
+		c.Ctx.WriteString("partial")
+		c.StopRun()
+	}
+	testAbortTrace = append(testAbortTrace, "unreachable")
+}
+
+func (c *testAbortController) Finish() {
+	testAbortTrace = append(testAbortTrace, "finish")
+}
+
+func TestAbort(t *testing.T) {
+	middleware.ErrorHandler("401", func(rw http.ResponseWriter, r *http.Request) { fmt.Fprint(rw, "login first") })
+	defer delete(middleware.ErrorMaps, "401")
+
+	p := NewControllerRegistor()
+	p.Add("/abort", &testAbortController{})
+	p.Use(func(next HandlerFunc) HandlerFunc {
+		return func(ctx *context.Context) {
+			next(ctx)
+			testAbortTrace = append(testAbortTrace, "middleware")
+		}
+	})
+	p.InsertFilter("/abort", BEFORE_EXEC, func(ctx *context.Context) {
+		if ctx.Input.Query("do") == "auth" {
+			ctx.Abort(401, "")
+		}
+	})
+	p.InsertFilter("/abort", AFTER_EXEC, func(ctx *context.Context) { testAbortTrace = append(testAbortTrace, "after") })
+
+	cases := []struct {
+		query string
+		code  int
+		body  string
+		trace string
+	}{
+		{"abort", 403, "nope", "finish after middleware"},
+		{"stop", 200, "partial", "finish after middleware"},
+		{"auth", 401, "login first", "middleware"},
+	}
+	for _, c := range cases {
+		testAbortTrace = nil
+		rw := httptest.NewRecorder()
+		p.ServeHTTP(rw, httptest.NewRequest("GET", "/abort?do="+c.query, nil))
+		if rw.Code != c.code || rw.Body.String() != c.body || strings.Join(testAbortTrace, " ") != c.trace {
+			t.Errorf("%s: expect %d %q %q, got %d %q %q", c.query, c.code, c.body, c.trace,
+				rw.Code, rw.Body.String(), strings.Join(testAbortTrace, " "))
+		}
+	}
+}
+
+type testSessionStore struct {
+	sid  string
+	data map[interface{}]interface{}
+}
+
+func (s *testSessionStore) Set(key, value interface{}) error { s.data[key] = value; return nil }
+func (s *testSessionStore) Get(key interface{}) interface{}  { return s.data[key] }
+func (s *testSessionStore) Delete(key interface{}) error     { delete(s.data, key); return nil }
+func (s *testSessionStore) SessionID() string                { return s.sid }
+func (s *testSessionStore) Flush() error {
+	s.data = make(map[interface{}]interface{})
+	return nil
+}
+
+type testSessionProvider map[string]*testSessionStore
+
+// 测试使用的内存 session, provider 只能注册一次, 在 init 中注册以便 go test -count 多次运行.
+func init() {
+	session.Register("testmemory", testSessionProvider{})
+}
+
+func (p testSessionProvider) SessionInit(int64, map[interface{}]interface{}) error { return nil }
+func (p testSessionProvider) SessionExists(sid string) bool                        { return p[sid] != nil }
+func (p testSessionProvider) SessionDestroy(sid string) error                      { delete(p, sid); return nil }
+func (p testSessionProvider) SessionRead(sid string) (session.SessionStore, error) {
+	if p[sid] == nil {
+		p[sid] = &testSessionStore{sid: sid, data: make(map[interface{}]interface{})}
+	}
+	return p[sid], nil
+}
+func (p testSessionProvider) SessionRegenerate(oldsid, sid string) (session.SessionStore, error) {
+	s, _ := p.SessionRead(oldsid)
+	delete(p, oldsid)
+	s.(*testSessionStore).sid = sid
+	p[sid] = s.(*testSessionStore)
+	return s, nil
+}
+
+type testSessionController struct {
+	Controller
+}
+
+func (c *testSessionController) Get() {
+	switch c.GetString("do") {
+	case "set":
+		c.SetSession("user", "bob")
+	case "login":
+		c.SessionRegenerate()
+	case "logout":
+		c.DestroySession()
+	case "del":
+		c.DelSession("user")
+	}
+	c.Ctx.WriteString(fmt.Sprint(c.GetSession("user")))
+}
+
+func TestSession(t *testing.T) {
+	manager, err := session.NewManager("testmemory", "sid", 3600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	on, sessions, mode := sessionOn, globalSessions, runMode
+	sessionOn, globalSessions, runMode = true, manager, "api"
+	defer func() { sessionOn, globalSessions, runMode = on, sessions, mode }()
+
+	p := NewControllerRegistor()
+	p.Add("/session", &testSessionController{})
+	var cookie *http.Cookie
+	for _, c := range []struct {
+		do        string
+		body      string
+		newCookie bool
+	}{
+		{"set", "bob", true},
+		{"get", "bob", false},
+		{"login", "bob", true},
+		{"get", "bob", false},
+		{"del", "<nil>", false},
+		{"set", "bob", false},
+		{"logout", "<nil>", true},
+	} {
+		r := httptest.NewRequest("GET", "/session?do="+c.do, nil)
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+		rw := httptest.NewRecorder()
+		p.ServeHTTP(rw, r)
+		cookies := rw.Result().Cookies()
+		if rw.Body.String() != c.body || (len(cookies) > 0) != c.newCookie {
+			t.Errorf("%s: expect %q new cookie %v, got %q %v", c.do, c.body, c.newCookie, rw.Body.String(), cookies)
+		}
+		if len(cookies) > 0 {
+			cookie = cookies[len(cookies)-1]
+		}
+	}
+}
+
+type testFlashController struct {
+	Controller
+}
+
+func (c *testFlashController) Post() {
+	flash := NewFlash()
+	flash.Notice("saved %d", 3)
+	flash.Error("a=b&c")
+	if err := flash.Store(&c.Controller); err != nil {
+		c.Ctx.WriteString(err.Error())
+		return
+	}
+	c.Redirect("/flash", 302)
+}
+
+func (c *testFlashController) Get() {
+	flash := ReadFromRequest(&c.Controller)
+	c.Ctx.WriteString(fmt.Sprint(c.Data["flash"].(map[string]string)["notice"], "|", flash.Data["error"]))
+}
+
+func TestFlash(t *testing.T) {
+	p := NewControllerRegistor()
+	p.Add("/flash", &testFlashController{})
+
+	on, sessions := sessionOn, globalSessions
+	defer func() { sessionOn, globalSessions = on, sessions }()
+	manager, err := session.NewManager("testmemory", "sid", 3600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 没有开启 session 并且没有 cookie key 时不保存 flash.
+	sessionOn = false
+	rw := httptest.NewRecorder()
+	p.ServeHTTP(rw, httptest.NewRequest("POST", "/flash", nil))
+	if rw.Body.String() != errFlashNoBackend.Error() || len(rw.Result().Cookies()) != 0 {
+		t.Errorf("expect flash refused without cookie keys, got %q %v", rw.Body.String(), rw.Result().Cookies())
+	}
+
+	context.SetCookieKeys([]string{"flash"})
+	defer context.SetCookieKeys(nil)
+	for _, on := range []bool{false, true} {
+		sessionOn, globalSessions = on, manager
+		var cookies []*http.Cookie
+		for i, c := range []struct {
+			method string
+			body   string
+		}{
+			{"POST", ""},
+			{"GET", "saved 3|a=b&c"},
+			{"GET", "|"},
+		} {
+			r := httptest.NewRequest(c.method, "/flash", nil)
+			for _, cookie := range cookies {
+				r.AddCookie(cookie)
+			}
+			rw := httptest.NewRecorder()
+			p.ServeHTTP(rw, r)
+			if rw.Body.String() != c.body {
+				t.Errorf("session %v request %d: expect %q, got %q", on, i, c.body, rw.Body.String())
+			}
+			for _, cookie := range rw.Result().Cookies() {
+				if cookie.MaxAge >= 0 && cookie.Value != "" {
+					cookies = []*http.Cookie{cookie}
+				} else {
+					cookies = nil
+				}
+			}
+		}
+	}
+}
+
+type testActionController struct {
+	Controller
+}
+
+func (c *testActionController) List(id int64, page int, tags []string) (interface{}, error) {
+	switch {
+	case page == 0:
+		return nil, nil
+	case page < 0:
+		return nil, &middleware.HTTPException{StatusCode: 403, Description: "denied"}
+	}
+	return map[string]interface{}{"id": id, "page": page, "tags": tags}, nil
+}
+
+func (c *testActionController) Count(n int) int { return n }
+
+func (c *testActionController) Matrix(m [][]string) int { return len(m) }
+
+func TestActionParams(t *testing.T) {
+	mode := runMode
+	runMode = "api"
+	defer func() { runMode = mode }()
+
+	p := NewControllerRegistor()
+	p.Add("/food/:id", &testActionController{}, "get:List(id,page,tag);post:Count(n)")
+	if p.Add("/bad", &testActionController{}, "get:List(id)").info != nil {
+		t.Errorf("expect param count mismatch rejected")
+	}
+	if p.Add("/matrix", &testActionController{}, "get:Matrix(m)").info != nil {
+		t.Errorf("expect [][]string param rejected")
+	}
+	if r := p.Routes()[0]; r.Methods["GET"] != "List(id,page,tag)" {
+		t.Errorf("expect route table to show params, got %v", r.Methods)
+	}
+
+	cases := []struct {
+		method string
+		url    string
+		code   int
+		body   string
+	}{
+		{"GET", "/food/7?page=2&tag=a&tag=b", 200, `{"id":7,"page":2,"tags":["a","b"]}`},
+		{"GET", "/food/7", 204, ""},
+		{"GET", "/food/7?page=-1", 403, `{"error":"denied"}`},
+		{"GET", "/food/7?page=x", 400, `{"error":"bind page from page=\"x\": strconv.ParseInt: parsing \"x\": invalid syntax"}`},
+		{"POST", "/food/7?n=5", 200, "5"},
+	}
+	for _, c := range cases {
+		rw := httptest.NewRecorder()
+		p.ServeHTTP(rw, httptest.NewRequest(c.method, c.url, nil))
+		if rw.Code != c.code || rw.Body.String() != c.body {
+			t.Errorf("%s %s: expect %d %q, got %d %q", c.method, c.url, c.code, c.body, rw.Code, rw.Body.String())
+		}
+	}
+}
+
+type testCtxKey string
+
+func TestRequestContext(t *testing.T) {
+	p := NewControllerRegistor()
+	p.InsertFilter("/*", BEFORE_ROUTER, func(ctx *context.Context) { ctx.SetValue(testCtxKey("user"), "bob") })
+	p.AddFunc("get", "/slow", func(ctx *context.Context) { <-ctx.Context().Done() }).Timeout(10 * time.Millisecond)
+	p.AddFunc("get", "/user", func(ctx *context.Context) {
+		if _, ok := ctx.Context().Deadline(); !ok {
+			ctx.WriteString(fmt.Sprint(ctx.Value(testCtxKey("user"))))
+		}
+	})
+
+	for _, c := range []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/slow", 503, "503 Service Unavailable\n"},
+		{"/user", 200, "bob"},
+	} {
+		rw := httptest.NewRecorder()
+		p.ServeHTTP(rw, httptest.NewRequest("GET", c.path, nil))
+		if rw.Code != c.code || rw.Body.String() != c.body {
+			t.Errorf("%s: expect %d %q, got %d %q", c.path, c.code, c.body, rw.Code, rw.Body.String())
+		}
+	}
+}
+
+type testPoolController struct {
+	Controller
+	hits int
+}
+
+func (c *testPoolController) Get() {
+	c.hits++
+	c.Data["seen"] = true
+	_, filtered := c.Data["filter"]
+	c.Ctx.WriteString(fmt.Sprintf("%d %s %d %v", c.hits, c.Ctx.Input.Param(":id"), len(c.Data), filtered))
+}
+
+func TestContextPool(t *testing.T) {
+	p := NewControllerRegistor()
+	p.Add("/pool/:id", &testPoolController{})
+	p.Add("/pool", &testPoolController{})
+	p.InsertFilter("/pool*", BEFORE_ROUTER, func(ctx *context.Context) { ctx.Input.Data["filter"] = true })
+	var kept, leaked *context.Context
+	p.AddFunc("get", "/keep", func(ctx *context.Context) {
+		ctx.Retain()
+		kept = ctx
+	})
+	p.AddFunc("get", "/leak", func(ctx *context.Context) { leaked = ctx })
+	done := make(chan string)
+	p.AddFunc("get", "/async/:id", func(ctx *context.Context) {
+		ctx.Retain()
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			done <- ctx.Input.Param(":id")
+		}()
+	})
+
+	// 复用的 controller, 参数以及 Data 都被重置, 过滤函数设置的 Input.Data 不会出现在 Data 中.
+	for _, c := range []struct {
+		path string
+		body string
+	}{
+		{"/pool/1", "1 1 1 false"},
+		{"/pool", "1  1 false"},
+		{"/pool/2", "1 2 1 false"},
+	} {
+		rw := httptest.NewRecorder()
+		p.ServeHTTP(rw, httptest.NewRequest("GET", c.path, nil))
+		if rw.Body.String() != c.body {
+			t.Errorf("%s: expect %q, got %q", c.path, c.body, rw.Body.String())
+		}
+	}
+
+	// Retain 之后的 context 不会被之后的请求复用.
+	p.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/keep", nil))
+	for i := 0; i < 10; i++ {
+		p.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/pool/3", nil))
+	}
+	if kept == nil || kept.Request == nil || kept.Request.URL.Path != "/keep" {
+		t.Errorf("expect retained context to keep its request, got %v", kept)
+	}
+
+	// 没有 Retain 时, 返回之后持有的 context 已经被清空.
+	p.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/leak", nil))
+	if leaked == nil || leaked.Request != nil || leaked.Input.Request != nil {
+		t.Errorf("expect context without Retain reset after return, got %v", leaked)
+	}
+
+	// Retain 之后在 goroutine 中使用, 之后的请求不影响 goroutine 读到的参数.
+	p.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/async/1", nil))
+	for i := 0; i < 10; i++ {
+		p.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/pool/3", nil))
+	}
+	if id := <-done; id != "1" {
+		t.Errorf("expect goroutine to read id 1, got %q", id)
+	}
+}
+
+func BenchmarkServeHTTP(b *testing.B) {
+	p := NewControllerRegistor()
+	p.Add("/pool/:id", &testPoolController{})
+	p.AddFunc("get", "/func/:id", func(ctx *context.Context) { ctx.WriteString(ctx.Input.Param(":id")) })
+
+	// nopool 每个请求都新建 Context 以及 controller, 用于对比复用的效果.
+	defer func() { disablePool = false }()
+	for _, mode := range []string{"pool", "nopool"} {
+		disablePool = mode == "nopool"
+		for _, path := range []string{"/pool/1", "/func/1"} {
+			b.Run(mode+path, func(b *testing.B) {
+				r := httptest.NewRequest("GET", path, nil)
+				rw := httptest.NewRecorder()
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					// dispatch 会把路由参数加到 RawQuery 中.
+					r.URL.RawQuery = ""
+					rw.Body.Reset()
+					p.ServeHTTP(rw, r)
+				}
+			})
+		}
+	}
+}
+
+func TestResponseStats(t *testing.T) {
+	p := NewControllerRegistor()
+	p.Add("/pool/:id", &testPoolController{})
+	p.AddFunc("get", "/fail", func(ctx *context.Context) { http.Error(ctx.ResponseWriter, "boom", 500) })
+	p.AddFunc("get", "/created", func(ctx *context.Context) { ctx.Output.Serve(201, "json", "ok", false) })
+
+	var stats []string
+	record := func(pos string) FilterFunc {
+		return func(ctx *context.Context) {
+			stats = append(stats, fmt.Sprintf("%s %d %d %v", pos, ctx.Output.ResponseStatus(), ctx.Output.BytesWritten(),
+				ctx.Output.TimeToFirstByte() > 0))
+		}
+	}
+	p.InsertFilter("/*", AFTER_EXEC, record("after"), false)
+	p.InsertFilter("/*", FINISH_ROUTER, record("finish"), false)
+
+	for _, c := range []struct {
+		path string
+		code int
+		pos  []string
+	}{
+		{"/pool/1", 200, []string{"after", "finish"}},
+		{"/fail", 500, []string{"after", "finish"}},
+		{"/created", 201, []string{"after", "finish"}},
+		{"/missing", 404, []string{"finish"}},
+	} {
+		stats = nil
+		rw := httptest.NewRecorder()
+		p.ServeHTTP(rw, httptest.NewRequest("GET", c.path, nil))
+		var expect []string
+		for _, pos := range c.pos {
+			expect = append(expect, fmt.Sprintf("%s %d %d true", pos, c.code, rw.Body.Len()))
+		}
+		if rw.Code != c.code || strings.Join(stats, "|") != strings.Join(expect, "|") {
+			t.Errorf("%s: expect %d %q, got %d %q", c.path, c.code, expect, rw.Code, stats)
+		}
+	}
+
+	// Status 字段为 SetStatus 设置的状态码, Is* 的参数为 0 时使用当前请求的状态码.
+	p.AddFunc("get", "/field", func(ctx *context.Context) {
+		ctx.Output.SetStatus(202)
+		ctx.WriteString(fmt.Sprint(ctx.Output.Status, ctx.Output.IsSuccessful(0), ctx.Output.IsNotFound(404), ctx.Output.IsOk(0)))
+	})
+	rw := httptest.NewRecorder()
+	p.ServeHTTP(rw, httptest.NewRequest("GET", "/field", nil))
+	if rw.Code != 202 || rw.Body.String() != "202 true true false" {
+		t.Errorf("expect 202 \"202 true true false\", got %d %q", rw.Code, rw.Body.String())
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	var entries []string
+	printf := accessLogPrintf
+	accessLogPrintf = func(format string, args ...interface{}) {
+		entries = append(entries, fmt.Sprintf(format, args...))
+	}
+	defer func() { accessLogPrintf = printf }()
+
+	p := NewControllerRegistor()
+	p.AddFunc("get", "/ok", func(ctx *context.Context) { ctx.WriteString("ok") })
+	p.AddFunc("get", "/abort", func(ctx *context.Context) { ctx.Abort(403, "denied") })
+	p.AddFunc("get", "/panic", func(ctx *context.Context) { panic("boom") })
+
+	// 每个请求都只记录一次, 状态码为最终输出的状态码.
+	for _, c := range []struct {
+		method string
+		path   string
+		code   int
+	}{
+		{"GET", "/ok", 200},
+		{"GET", "/abort", 403},
+		{"GET", "/panic", 500},
+		{"GET", "/missing", 404},
+		{"POST", "/ok", 405},
+	} {
+		entries = nil
+		p.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(c.method, c.path, nil))
+		expect := fmt.Sprintf(" %s example.com %s %d ", c.path, c.method, c.code)
+		if len(entries) != 1 || !strings.Contains(entries[0], expect) {
+			t.Errorf("%s %s: expect one access log with %q, got %q", c.method, c.path, expect, entries)
+		}
+	}
+}
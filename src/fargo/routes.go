@@ -0,0 +1,307 @@
+package fargo
+
+import (
+	"bdlib/comm"
+	"bdlib/util"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// filterPosNames 过滤函数执行位置的名称, 用于输出路由表.
+var filterPosNames = []string{"BEFORE_STATIC", "BEFORE_ROUTER", "BEFORE_EXEC", "AFTER_EXEC", "FINISH_ROUTER"}
+
+// RouteInfo 路由表中的一条路由, 由 App.Routes 返回, debug 模式下启动时会输出路由表.
+type RouteInfo struct {
+	// 注册的 URI.
+	Pattern string
+
+	// 绑定的域名, 为空时不限制域名.
+	Host string
+
+	// 处理的 http 方法, key: 大写的 http 方法或者 "*", value: 执行的方法名.
+	Methods map[string]string
+
+	// controller 类型, 函数路由为函数名, 挂载的 http.Handler 为 handler 类型.
+	Controller string
+
+	// 作用于此路由的过滤函数, 如 "BEFORE_ROUTER main.auth", 绑定到路由上的过滤函数带有 (route) 后缀.
+	Filters []string
+
+	// 是否为智能路由.
+	Auto bool
+}
+
+// routeSegment 路由 URI 中的一段, 用于检测路由冲突.
+type routeSegment struct {
+	// 固定的路径, 参数段为空.
+	static string
+
+	// 是否为参数段.
+	wild bool
+
+	// 参数段的正则, 不含参数名称, 普通参数为 ":", 全匹配为 "*" 和 "*.*".
+	regexp string
+}
+
+// catchAll 参数段是否匹配任意内容.
+func (s routeSegment) catchAll() bool {
+	switch s.regexp {
+	case ":", "*", "*.*", "(.+)", "(.*)", "([^/]+)":
+		return true
+	}
+	return false
+}
+
+// parseRouteSegments 解析并校验路由 URI, 返回路由的每一段以及路由在路由树中的优先级,
+// 优先级和 leafInfo.priority 一致, 固定路由为 0, 正则路由为 1, 普通参数为 2, 全匹配为 3.
+// Parameters:
+// - pattern: 路由 URI.
+// Return:
+// - segments: 路由的每一段.
+// - priority: 路由的优先级.
+// - err:      非法的路由 URI.
+func parseRouteSegments(pattern string) (segments []routeSegment, priority int, err error) {
+	if !strings.HasPrefix(pattern, "/") {
+		return nil, 0, fmt.Errorf("invalid route pattern %s: must begin with /", pattern)
+	}
+
+	var hasRegexp, hasParam, hasSplat bool
+	for _, seg := range splitPath(pattern) {
+		if seg == "" {
+			return nil, 0, fmt.Errorf("invalid route pattern %s: empty segment", pattern)
+		}
+		iswild, params, regexpStr := splitSegment(seg)
+		if !iswild {
+			segments = append(segments, routeSegment{static: seg})
+			continue
+		}
+
+		if strings.Count(seg, "(") != strings.Count(seg, ")") {
+			return nil, 0, fmt.Errorf("invalid route pattern %s: unbalanced parentheses in %s", pattern, seg)
+		}
+		for _, param := range typedParams(seg) {
+			if _, ok := paramTypes[param[1]]; !ok {
+				return nil, 0, fmt.Errorf("invalid route pattern %s: unknown param type %s in %s", pattern, param[1], seg)
+			}
+		}
+		s := routeSegment{wild: true, regexp: regexpStr}
+		var names int
+		for _, p := range params {
+			switch p {
+			case ":splat", ":path", ":ext":
+				hasSplat = true
+				names++
+			case ":", ".":
+			default:
+				names++
+			}
+		}
+		if names == 0 {
+			return nil, 0, fmt.Errorf("invalid route pattern %s: missing param name in %s", pattern, seg)
+		}
+		switch {
+		case seg == "*" || seg == "*.*":
+			s.regexp = seg
+		case regexpStr == "":
+			s.regexp = ":"
+			hasParam = true
+		default:
+			if _, err = regexp.Compile("^" + regexpStr + "$"); err != nil {
+				return nil, 0, fmt.Errorf("invalid route pattern %s: %v", pattern, err)
+			}
+			hasRegexp = true
+		}
+		segments = append(segments, s)
+	}
+
+	switch {
+	case hasSplat:
+		priority = 3
+	case hasRegexp:
+		priority = 1
+	case hasParam:
+		priority = 2
+	}
+
+	return
+}
+
+// routeMethods 返回路由加入的路由树对应的 http 方法.
+// Parameters:
+// - route: 路由信息.
+// Return:
+// - methods: 小写的 http 方法.
+func routeMethods(route *controllerInfo) (methods []string) {
+	if _, ok := route.methods["*"]; !route.hasMethod || ok {
+		return HTTPMETHOD
+	}
+	for _, m := range HTTPMETHOD {
+		if _, ok := route.methods[m]; ok {
+			methods = append(methods, m)
+		}
+	}
+
+	return
+}
+
+// checkRoute 检测路由是否和已经注册的路由冲突.
+// 相同域名下 http 方法有交集的两个路由, 如果每一段都相同则为重复路由, 后注册的路由永远不会被匹配;
+// 如果优先级相同, 并且已经注册的路由每一个参数段都匹配任意内容或者和新路由相同, 则新路由被遮蔽,
+// 如先注册 /post/:id(.+) 再注册 /post/:id([0-9]+).
+// Parameters:
+// - route: 新的路由信息, segments 和 priority 已经解析.
+// Return:
+// - duplicate: 和新路由重复的路由.
+// - shadowed:  遮蔽了新路由的路由.
+func (p *ControllerRegistor) checkRoute(route *controllerInfo) (duplicate, shadowed *controllerInfo) {
+	methods := routeMethods(route)
+	for _, r := range p.routes {
+		if r.auto || r.host != route.host || len(r.segments) != len(route.segments) {
+			continue
+		}
+		overlap := false
+		for _, m := range routeMethods(r) {
+			if util.InSlice(m, methods) {
+				overlap = true
+				break
+			}
+		}
+		if !overlap {
+			continue
+		}
+
+		same, covered := true, r.priority == route.priority
+		for i, s := range r.segments {
+			ns := route.segments[i]
+			if s != ns {
+				same = false
+			}
+			if s.wild != ns.wild || !s.wild && s.static != ns.static ||
+				s.wild && !s.catchAll() && s.regexp != ns.regexp {
+				covered = false
+			}
+		}
+		if same {
+			return r, nil
+		}
+		if covered && shadowed == nil {
+			shadowed = r
+		}
+	}
+
+	return
+}
+
+// routeError 记录并输出注册路由时的错误, strictrouter 模式下启动时存在错误则启动失败.
+// Parameters:
+// - err: 错误信息.
+func (p *ControllerRegistor) routeError(err error) {
+	p.errs = append(p.errs, err)
+	fmt.Println(comm.WrapError(err))
+}
+
+// RouteErrors 返回注册路由时的所有错误, 包括重复的路由, 被遮蔽的路由, 非法的路由 URI 以及重复的路由和过滤函数名称.
+func (p *ControllerRegistor) RouteErrors() (errs []error) {
+	return p.errs
+}
+
+// Routes 按照注册的顺序返回所有路由.
+func (p *ControllerRegistor) Routes() (routes []RouteInfo) {
+	for _, r := range p.routes {
+		info := RouteInfo{
+			Pattern: r.pattern,
+			Host:    r.host,
+			Methods: make(map[string]string),
+			Auto:    r.auto,
+		}
+		switch {
+		case r.httpHandler != nil:
+			info.Controller = fmt.Sprintf("%T", r.httpHandler)
+		case r.handler != nil:
+			info.Controller = funcName(r.handler)
+		default:
+			info.Controller = r.controllerType.String()
+		}
+		if r.hasMethod {
+			for m, f := range r.methods {
+				if params := r.actionParams[f]; len(params) > 0 {
+					f += "(" + strings.Join(params, ",") + ")"
+				}
+				info.Methods[strings.ToUpper(m)] = f
+			}
+		} else {
+			for m := range r.overridden {
+				info.Methods[strings.ToUpper(m)] = strings.Title(m)
+			}
+		}
+
+		pattern := r.pattern
+		if !RouterCaseSensitive {
+			pattern = strings.ToLower(pattern)
+		}
+		for pos, name := range filterPosNames {
+			for _, f := range p.filters[pos] {
+				if ok, _ := f.ValidRouter(pattern); ok {
+					info.Filters = append(info.Filters, name+" "+f.label())
+				}
+			}
+			for _, f := range r.filters[pos] {
+				info.Filters = append(info.Filters, name+" "+f.label()+" (route)")
+			}
+		}
+		routes = append(routes, info)
+	}
+
+	return
+}
+
+// PrintRoutes 以表格的形式输出路由表.
+// Parameters:
+// - w: 输出的位置, 如 os.Stdout.
+func (p *ControllerRegistor) PrintRoutes(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "PATTERN\tHOST\tMETHODS\tCONTROLLER\tFILTERS")
+	for _, r := range p.Routes() {
+		var methods []string
+		for m, f := range r.Methods {
+			methods = append(methods, m+":"+f)
+		}
+		sort.Strings(methods)
+		pattern := r.Pattern
+		if r.Auto {
+			pattern += " (auto)"
+		}
+		host := r.Host
+		if host == "" {
+			host = "*"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", pattern, host, strings.Join(methods, ","),
+			r.Controller, strings.Join(r.Filters, ","))
+	}
+	tw.Flush()
+}
+
+// funcName 返回函数的名称, 如 main.auth.
+func funcName(f interface{}) string {
+	if fn := runtime.FuncForPC(reflect.ValueOf(f).Pointer()); fn != nil {
+		return fn.Name()
+	}
+	return ""
+}
+
+// anonymousFuncRegexp 匹配匿名函数的名称, 如 main.main.func1, main.glob..func2.1.
+var anonymousFuncRegexp = regexp.MustCompile(`\.func[0-9]+(\.[0-9]+)*$`)
+
+// filterName 返回过滤函数默认的名称, 即函数名, 匿名函数的名称不稳定并且可能重复, 返回空.
+func filterName(filter FilterFunc) string {
+	if name := funcName(filter); !anonymousFuncRegexp.MatchString(name) {
+		return name
+	}
+	return ""
+}
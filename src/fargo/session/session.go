@@ -170,7 +170,7 @@ func (m *Manager) SessionDestroy(w http.ResponseWriter, r *http.Request) {
 func (m *Manager) SessionRegenerate(w http.ResponseWriter, r *http.Request) (session SessionStore) {
 	sid := m.sessionID(r)
 	cookie, err := r.Cookie(m.cookieName)
-	if err != nil && cookie.Value == "" {
+	if err != nil || cookie.Value == "" {
 		session, _ = m.provider.SessionRead(sid)
 		cookie = &http.Cookie{
 			Name:     m.cookieName,
@@ -41,6 +41,9 @@ func init() {
 	FargoTemplates = make(map[string]*template.Template)
 	FargoTemplateExt = make([]string, 0)
 	FargoTemplateExt = append(FargoTemplateExt, "tpl", "html")
+
+	// 反向生成 url, 如 {{urlfor "UserController.Get" ":id" 12}}.
+	fargoTplFuncMap["urlfor"] = URLFor
 }
 
 // AddFuncMap 用户可以添加模板函数.
@@ -186,9 +186,9 @@ func (t *Tree) addseg(segments []string, route interface{}, wildcards []string,
 				}
 				filterCards = append(filterCards, v)
 			}
-			t.leaves = append(t.leaves, &leafInfo{runObject: route, wildcards: filterCards, regexps: regexp.MustCompile("^" + reg + "$")})
+			t.addLeaf(&leafInfo{runObject: route, wildcards: filterCards, regexps: regexp.MustCompile("^" + reg + "$")})
 		} else {
-			t.leaves = append(t.leaves, &leafInfo{runObject: route, wildcards: wildcards})
+			t.addLeaf(&leafInfo{runObject: route, wildcards: wildcards})
 		}
 	} else {
 		seg := segments[0]
@@ -249,6 +249,17 @@ func (t *Tree) addseg(segments []string, route interface{}, wildcards []string,
 	}
 }
 
+// addLeaf insert the leaf ordered by priority, leaves with the same priority keep the insertion order.
+func (t *Tree) addLeaf(leaf *leafInfo) {
+	i := len(t.leaves)
+	for i > 0 && t.leaves[i-1].priority() > leaf.priority() {
+		i--
+	}
+	t.leaves = append(t.leaves, nil)
+	copy(t.leaves[i+1:], t.leaves[i:])
+	t.leaves[i] = leaf
+}
+
 // Match match router to runObject & params
 func (t *Tree) Match(pattern string) (runObject interface{}, params map[string]string) {
 	if len(pattern) == 0 || pattern[0] != '/' {
@@ -320,6 +331,20 @@ type leafInfo struct {
 	runObject interface{}
 }
 
+// priority static leaf first, then typed params (:id:int, :name:string), then params, then splats.
+func (leaf *leafInfo) priority() int {
+	if len(leaf.wildcards) == 0 {
+		return 0
+	}
+	if util.InSlice(":splat", leaf.wildcards) || util.InSlice(".", leaf.wildcards) {
+		return 3
+	}
+	if leaf.regexps != nil {
+		return 1
+	}
+	return 2
+}
+
 func (leaf *leafInfo) match(wildcardValues []string) (ok bool, params map[string]string) {
 	if leaf.regexps == nil {
 		// has error
@@ -424,6 +449,7 @@ func splitPath(key string) []string {
 // "?:id" -> true, [: :id], ""        : meaning can empty
 // ":id:int" -> true, [:id], ([0-9]+)
 // ":name:string" -> true, [:name], ([\w]+)
+// ":id:int64" -> true, [:id], (-?[0-9]+)      types registered by AddParamType
 // ":id([0-9]+)" -> true, [:id], ([0-9]+)
 // ":id([0-9]+)_:name" -> true, [:id :name], ([0-9]+)_(.+)
 // "cms_:id_:page.html" -> true, [:id :page], cms_(.+)_(.+).html
@@ -452,31 +478,17 @@ func splitSegment(key string) (bool, []string, string) {
 				continue
 			}
 			if start {
-				//:id:int and :name:string
+				//:id:int, :name:string and other types registered by AddParamType
 				if v == ':' {
-					if len(key) >= i+4 {
-						if key[i+1:i+4] == "int" {
-							out = append(out, []rune("([0-9]+)")...)
-							params = append(params, ":"+string(param))
-							start = false
-							startexp = false
-							skipnum = 3
-							param = make([]rune, 0)
-							paramsNum++
-							continue
-						}
-					}
-					if len(key) >= i+7 {
-						if key[i+1:i+7] == "string" {
-							out = append(out, []rune(`([\w]+)`)...)
-							params = append(params, ":"+string(param))
-							paramsNum++
-							start = false
-							startexp = false
-							skipnum = 6
-							param = make([]rune, 0)
-							continue
-						}
+					if name, pt := lookupParamType(key[i+1:]); pt != nil {
+						out = append(out, []rune("("+pt.regexp+")")...)
+						params = append(params, ":"+string(param))
+						start = false
+						startexp = false
+						skipnum = len(name)
+						param = make([]rune, 0)
+						paramsNum++
+						continue
 					}
 				}
 				// params only support a-zA-Z0-9
@@ -0,0 +1,479 @@
+package validation
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// MessageTmpls 各个规则的错误信息模板, 只能在启动时直接修改, 开始处理请求之后通过 SetMessageTmpls 覆盖,
+// 模板中 {field} 替换为参数名称, {0}, {1} 依次替换为规则的参数, 如 range(1,100) 中的 1 和 100.
+var MessageTmpls = map[string]string{
+	"required": "{field} is required",
+	"range":    "{field} must be between {0} and {1}",
+	"min":      "{field} must be at least {0}",
+	"max":      "{field} must be at most {0}",
+	"minlen":   "{field} must be at least {0} characters",
+	"maxlen":   "{field} must be at most {0} characters",
+	"length":   "{field} must be exactly {0} characters",
+	"email":    "{field} must be a valid email address",
+	"mobile":   "{field} must be a valid mobile number",
+	"ip":       "{field} must be a valid ip address",
+	"alpha":    "{field} must contain only letters",
+	"numeric":  "{field} must contain only digits",
+	"match":    "{field} must match {0}",
+}
+
+// tmplsLock 保护 MessageTmpls, SetMessageTmpls 和校验可能同时进行.
+var tmplsLock sync.RWMutex
+
+var (
+	emailRegexp   = regexp.MustCompile(`^[\w.%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}$`)
+	mobileRegexp  = regexp.MustCompile(`^(\+?86)?1[3-9][0-9]{9}$`)
+	alphaRegexp   = regexp.MustCompile(`^[A-Za-z]+$`)
+	numericRegexp = regexp.MustCompile(`^[0-9]+$`)
+	timeType      = reflect.TypeOf(time.Time{})
+)
+
+// SetMessageTmpls 覆盖规则的错误信息模板, 没有指定的规则保持不变.
+// Parameters:
+// - tmpls: key: 规则名称, 如 required, value: 错误信息模板, 如 "{field} 不能为空".
+func SetMessageTmpls(tmpls map[string]string) {
+	tmplsLock.Lock()
+	defer tmplsLock.Unlock()
+	for rule, tmpl := range tmpls {
+		MessageTmpls[rule] = tmpl
+	}
+}
+
+// Error 某个字段的校验错误.
+type Error struct {
+	// 参数名称, 和 Bind 使用的名称一致, 依次取 form tag, json tag 以及字段名.
+	Field string `json:"field"`
+
+	// 没有通过的规则, 如 required.
+	Rule string `json:"rule"`
+
+	// 规则的参数, 如 range(1,100) 中的 1 和 100.
+	Params []string `json:"-"`
+
+	// 字段的值.
+	Value interface{} `json:"-"`
+
+	// 错误信息.
+	Message string `json:"message"`
+}
+
+// Error 实现 error 接口.
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Errors 所有字段的校验错误.
+type Errors []*Error
+
+// Error 实现 error 接口.
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Map 返回参数名称到错误信息的映射, 同一个参数只保留第一个错误, 便于模板中使用 {{index .Errors.Map "name"}}.
+func (e Errors) Map() (m map[string]string) {
+	m = make(map[string]string, len(e))
+	for _, err := range e {
+		if _, ok := m[err.Field]; !ok {
+			m[err.Field] = err.Message
+		}
+	}
+	return
+}
+
+// rule 解析之后的校验规则.
+type rule struct {
+	name   string
+	params []string
+	re     *regexp.Regexp
+}
+
+// field 需要校验的字段.
+type field struct {
+	index []int
+	name  string
+	rules []*rule
+}
+
+// cache 解析过的结构体的校验规则, key: reflect.Type.
+var (
+	cacheLock sync.RWMutex
+	cache     = make(map[reflect.Type][]*field)
+)
+
+// Validate 根据 struct tag 校验结构体, 如
+//
+//	type UserForm struct {
+//		Name  string `form:"name" valid:"required;maxlen(32)"`
+//		Age   int    `form:"age" valid:"range(1,100)"`
+//		Email string `form:"email" valid:"email"`
+//		Code  string `form:"code" valid:"match(/^[a-z]+$/)"`
+//	}
+//
+// 规则之间用 ";" 分隔, 支持 required, range(min,max), min(n), max(n), minlen(n), maxlen(n), length(n),
+// email, mobile, ip, alpha, numeric, match(/regexp/), 0 和 "" 等零值同样会被校验, 如 range(1,100) 不接受 0,
+// 可选的参数使用指针, 如 *int, 为 nil 时除了 required 之外不会校验其他规则.
+// 数值类型校验值的大小, 字符串以及切片校验长度, 嵌套的结构体会递归校验.
+// Parameters:
+// - obj:  结构体或者结构体指针.
+// Return:
+// - errs: 没有通过校验的字段, 全部通过时为空.
+// - err:  obj 不是结构体或者 valid tag 非法.
+func Validate(obj interface{}) (errs Errors, err error) {
+	v := reflect.Indirect(reflect.ValueOf(obj))
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("validation: obj must be a struct or a pointer to struct, got %T", obj)
+	}
+	err = validateStruct(v, "", &errs)
+	return
+}
+
+// validateStruct 校验结构体的每一个字段.
+// Parameters:
+// - v:      结构体.
+// - prefix: 嵌套结构体的参数名前缀.
+// - errs:   没有通过校验的字段.
+// Return:
+// - err:    valid tag 非法.
+func validateStruct(v reflect.Value, prefix string, errs *Errors) (err error) {
+	fields, err := parseStruct(v.Type())
+	if err != nil {
+		return
+	}
+
+	for _, f := range fields {
+		fv, ok := fieldByIndex(v, f.index)
+		if !ok {
+			continue
+		}
+		for _, r := range f.rules {
+			if ok := r.check(fv); !ok {
+				*errs = append(*errs, newError(prefix+f.name, r, fv))
+				break
+			}
+		}
+		if fv.Kind() == reflect.Ptr && !fv.IsNil() {
+			fv = fv.Elem()
+		}
+		if fv.Kind() == reflect.Struct && fv.Type() != timeType {
+			if err = validateStruct(fv, prefix+f.name+".", errs); err != nil {
+				return
+			}
+		}
+	}
+
+	return
+}
+
+// fieldByIndex 同 reflect.Value.FieldByIndex, 匿名结构体指针为 nil 时返回 false.
+func fieldByIndex(v reflect.Value, index []int) (fv reflect.Value, ok bool) {
+	fv = v
+	for i, x := range index {
+		if i > 0 && fv.Kind() == reflect.Ptr {
+			if fv.IsNil() {
+				return fv, false
+			}
+			fv = fv.Elem()
+		}
+		fv = fv.Field(x)
+	}
+	return fv, true
+}
+
+// newError 根据规则的错误信息模板生成字段的校验错误.
+func newError(name string, r *rule, fv reflect.Value) *Error {
+	tmplsLock.RLock()
+	tmpl, ok := MessageTmpls[r.name]
+	tmplsLock.RUnlock()
+	if !ok {
+		tmpl = "{field} is invalid"
+	}
+	msg := strings.Replace(tmpl, "{field}", name, -1)
+	for i, p := range r.params {
+		msg = strings.Replace(msg, "{"+strconv.Itoa(i)+"}", p, -1)
+	}
+
+	var value interface{}
+	if fv.CanInterface() {
+		value = fv.Interface()
+	}
+	return &Error{Field: name, Rule: r.name, Params: r.params, Value: value, Message: msg}
+}
+
+// parseStruct 解析结构体中需要校验的字段, 解析结果会被缓存.
+// Parameters:
+// - t:      结构体类型.
+// Return:
+// - fields: 需要校验的字段, 包括没有 valid tag 的嵌套结构体.
+// - err:    valid tag 非法.
+func parseStruct(t reflect.Type) (fields []*field, err error) {
+	cacheLock.RLock()
+	fields, ok := cache[t]
+	cacheLock.RUnlock()
+	if ok {
+		return
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		ft := sf.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+
+		// 匿名结构体的字段作为外层结构体的字段.
+		if sf.Anonymous && ft.Kind() == reflect.Struct && sf.Tag.Get("valid") == "" {
+			var sub []*field
+			if sub, err = parseStruct(ft); err != nil {
+				return nil, err
+			}
+			for _, f := range sub {
+				fields = append(fields, &field{index: append([]int{i}, f.index...), name: f.name, rules: f.rules})
+			}
+			continue
+		}
+
+		tag := sf.Tag.Get("valid")
+		if tag == "-" || tag == "" && (ft.Kind() != reflect.Struct || ft == timeType) {
+			continue
+		}
+		f := &field{index: []int{i}, name: fieldName(sf)}
+		if f.rules, err = parseRules(tag); err != nil {
+			return nil, fmt.Errorf("validation: %s.%s: %v", t.Name(), sf.Name, err)
+		}
+		fields = append(fields, f)
+	}
+
+	cacheLock.Lock()
+	cache[t] = fields
+	cacheLock.Unlock()
+
+	return
+}
+
+// fieldName 返回字段对应的参数名称, 依次取 form tag, json tag 以及字段名.
+func fieldName(sf reflect.StructField) (name string) {
+	for _, key := range []string{"form", "json"} {
+		name = sf.Tag.Get(key)
+		if i := strings.Index(name, ","); i != -1 {
+			name = name[:i]
+		}
+		if name != "" && name != "-" {
+			return
+		}
+	}
+	return sf.Name
+}
+
+// parseRules 解析 valid tag, 如 required;range(1,100);match(/^[a-z;]+$/).
+// Parameters:
+// - tag:   valid tag.
+// Return:
+// - rules: 校验规则.
+// - err:   未知的规则或者参数非法.
+func parseRules(tag string) (rules []*rule, err error) {
+	for tag = strings.TrimSpace(tag); tag != ""; tag = strings.TrimSpace(tag) {
+		var s string
+		if strings.HasPrefix(tag, "match(/") {
+			// 正则中可能包含 ";" 以及 ")", 以 "/)" 作为结束.
+			end := strings.Index(tag[len("match(/"):], "/)")
+			if end == -1 {
+				return nil, fmt.Errorf("invalid rule %s: missing /)", tag)
+			}
+			end += len("match(/") + len("/)")
+			s, tag = tag[:end], strings.TrimPrefix(tag[end:], ";")
+		} else if i := strings.Index(tag, ";"); i != -1 {
+			s, tag = tag[:i], tag[i+1:]
+		} else {
+			s, tag = tag, ""
+		}
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+
+		r := &rule{name: s}
+		if i := strings.Index(s, "("); i != -1 {
+			if !strings.HasSuffix(s, ")") {
+				return nil, fmt.Errorf("invalid rule %s: missing )", s)
+			}
+			r.name = s[:i]
+			if r.name == "match" {
+				r.params = []string{s[i+1 : len(s)-1]}
+			} else {
+				for _, p := range strings.Split(s[i+1:len(s)-1], ",") {
+					r.params = append(r.params, strings.TrimSpace(p))
+				}
+			}
+		}
+		if err = r.compile(); err != nil {
+			return nil, fmt.Errorf("invalid rule %s: %v", s, err)
+		}
+		rules = append(rules, r)
+	}
+
+	return
+}
+
+// ruleParams 每一个规则的参数个数.
+var ruleParams = map[string]int{
+	"required": 0, "range": 2, "min": 1, "max": 1, "minlen": 1, "maxlen": 1, "length": 1,
+	"email": 0, "mobile": 0, "ip": 0, "alpha": 0, "numeric": 0, "match": 1,
+}
+
+// compile 校验规则的参数, 并编译 match 规则的正则.
+func (r *rule) compile() (err error) {
+	n, ok := ruleParams[r.name]
+	if !ok {
+		return fmt.Errorf("unknown rule %s", r.name)
+	}
+	if len(r.params) != n {
+		return fmt.Errorf("expect %d params, got %d", n, len(r.params))
+	}
+
+	switch r.name {
+	case "match":
+		expr := r.params[0]
+		if len(expr) < 2 || expr[0] != '/' || expr[len(expr)-1] != '/' {
+			return fmt.Errorf("regexp must be enclosed in /")
+		}
+		r.re, err = regexp.Compile(expr[1 : len(expr)-1])
+	case "range", "min", "max":
+		for _, p := range r.params {
+			if _, err = strconv.ParseFloat(p, 64); err != nil {
+				return
+			}
+		}
+	case "minlen", "maxlen", "length":
+		_, err = strconv.Atoi(r.params[0])
+	}
+
+	return
+}
+
+// check 校验字段的值是否符合规则.
+// Parameters:
+// - fv: 字段的值.
+// Return:
+// - ok: 是否通过校验.
+func (r *rule) check(fv reflect.Value) (ok bool) {
+	if !fv.IsValid() {
+		return r.name != "required"
+	}
+	if fv.Kind() == reflect.Ptr || fv.Kind() == reflect.Interface {
+		// 指针为 nil 表示没有传参数, 不为 nil 时即使指向零值也满足 required.
+		if fv.IsNil() {
+			return r.name != "required"
+		}
+		if r.name == "required" {
+			return true
+		}
+		return r.check(fv.Elem())
+	}
+
+	switch r.name {
+	case "required":
+		return !isEmpty(fv)
+	case "range", "min", "max":
+		n, isNum := number(fv)
+		if !isNum {
+			n = float64(length(fv))
+		}
+		min, _ := strconv.ParseFloat(r.params[0], 64)
+		switch r.name {
+		case "range":
+			max, _ := strconv.ParseFloat(r.params[1], 64)
+			return n >= min && n <= max
+		case "min":
+			return n >= min
+		default:
+			return n <= min
+		}
+	case "minlen", "maxlen", "length":
+		n, _ := strconv.Atoi(r.params[0])
+		l := length(fv)
+		switch r.name {
+		case "minlen":
+			return l >= n
+		case "maxlen":
+			return l <= n
+		default:
+			return l == n
+		}
+	}
+
+	s := fmt.Sprint(fv.Interface())
+	switch r.name {
+	case "email":
+		return emailRegexp.MatchString(s)
+	case "mobile":
+		return mobileRegexp.MatchString(s)
+	case "ip":
+		return net.ParseIP(s) != nil
+	case "alpha":
+		return alphaRegexp.MatchString(s)
+	case "numeric":
+		return numericRegexp.MatchString(s)
+	case "match":
+		return r.re.MatchString(s)
+	}
+
+	return false
+}
+
+// isEmpty 不是指针的字段是否为空值, 用于 required, 0, false, "" 以及空的切片和 map 都是空值.
+func isEmpty(fv reflect.Value) bool {
+	switch fv.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return fv.Len() == 0
+	case reflect.Struct:
+		if fv.Type() == timeType {
+			return fv.Interface().(time.Time).IsZero()
+		}
+		return false
+	}
+	return fv.IsValid() && fv.Interface() == reflect.Zero(fv.Type()).Interface()
+}
+
+// number 返回数值类型字段的值.
+func number(fv reflect.Value) (n float64, ok bool) {
+	switch fv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(fv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(fv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return fv.Float(), true
+	}
+	return 0, false
+}
+
+// length 返回字段的长度, 字符串为字符个数.
+func length(fv reflect.Value) int {
+	switch fv.Kind() {
+	case reflect.String:
+		return utf8.RuneCountInString(fv.String())
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return fv.Len()
+	}
+	return len(fmt.Sprint(fv.Interface()))
+}
@@ -0,0 +1,114 @@
+package validation
+
+import (
+	"testing"
+)
+
+type testForm struct {
+	Name  string  `form:"name" valid:"required;maxlen(5)"`
+	Age   int     `json:"age" valid:"range(1,100)"`
+	Email string  `valid:"email"`
+	Phone *string `valid:"mobile"`
+	Code  string  `form:"code" valid:"match(/^[a-z;]+$/)"`
+	Inner struct {
+		City string `form:"city" valid:"required"`
+	} `form:"inner"`
+}
+
+func TestValidate(t *testing.T) {
+	phone, empty, zero := "+8613800138000", "", 0
+	cases := []struct {
+		obj    interface{}
+		expect string
+	}{
+		{&testForm{Name: "abcdef", Age: 101, Email: "a@b", Code: "ab;c"},
+			"name must be at most 5 characters; age must be between 1 and 100; " +
+				"Email must be a valid email address; inner.city is required"},
+		{&testForm{Name: "bob", Age: 18, Email: "bob@example.com", Phone: &phone, Code: "x"},
+			"inner.city is required"},
+		{&testForm{Phone: &empty},
+			"name is required; age must be between 1 and 100; Email must be a valid email address; " +
+				"Phone must be a valid mobile number; code must match /^[a-z;]+$/; inner.city is required"},
+		// 零值同样会被校验, 只有 nil 指针被跳过.
+		{&struct {
+			Age   int      `valid:"range(1,100)"`
+			Min   int      `valid:"min(1)"`
+			Opt   *int     `valid:"range(1,100)"`
+			Req   *int     `valid:"required"`
+			Zero  *int     `valid:"required;min(1)"`
+			Flags []string `valid:"required"`
+		}{Zero: &zero},
+			"Age must be between 1 and 100; Min must be at least 1; Req is required; Zero must be at least 1; Flags is required"},
+		{&struct {
+			IP   string `valid:"ip"`
+			Nick string `valid:"alpha;minlen(2)"`
+			Zip  string `valid:"numeric;length(6)"`
+		}{"127.0.0.256", "a", "51800"},
+			"IP must be a valid ip address; Nick must be at least 2 characters; Zip must be exactly 6 characters"},
+		{&struct {
+			Tags  []string `valid:"min(1);max(2)"`
+			Score float64  `valid:"max(9.5)"`
+		}{[]string{"a", "b", "c"}, 10},
+			"Tags must be at most 2; Score must be at most 9.5"},
+	}
+	for i, c := range cases {
+		errs, err := Validate(c.obj)
+		if err != nil || errs.Error() != c.expect {
+			t.Errorf("case %d: expect %q, got %q %v", i, c.expect, errs.Error(), err)
+		}
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	cases := []struct {
+		tag   string
+		rules []string
+		ok    bool
+	}{
+		{"required;range(1, 100)", []string{"required", "range"}, true},
+		{"match(/^[a-z;)]+$/);maxlen(5)", []string{"match", "maxlen"}, true},
+		{"unknown", nil, false},
+		{"range(1)", nil, false},
+		{"min(a)", nil, false},
+		{"match(/[a-z/", nil, false},
+		{"match([a-z])", nil, false},
+	}
+	for _, c := range cases {
+		rules, err := parseRules(c.tag)
+		if (err == nil) != c.ok || len(rules) != len(c.rules) {
+			t.Errorf("%s: expect %v, got %d rules %v", c.tag, c.rules, len(rules), err)
+			continue
+		}
+		for i, r := range rules {
+			if r.name != c.rules[i] {
+				t.Errorf("%s: expect rule %s, got %s", c.tag, c.rules[i], r.name)
+			}
+		}
+	}
+
+	if _, err := Validate(testForm{}); err != nil {
+		t.Errorf("expect struct value accepted, got %v", err)
+	}
+	if _, err := Validate("name"); err == nil {
+		t.Error("expect error for non-struct obj")
+	}
+}
+
+func TestMessageTmpls(t *testing.T) {
+	// 校验的同时修改模板, 配合 -race 检查.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			Validate(&testForm{})
+		}
+	}()
+	SetMessageTmpls(map[string]string{"required": "{field} 不能为空"})
+	<-done
+	defer SetMessageTmpls(map[string]string{"required": "{field} is required"})
+
+	errs, _ := Validate(&testForm{Name: "bob", Age: 1, Email: "bob@example.com", Code: "x"})
+	if m := errs.Map(); len(m) != 1 || m["inner.city"] != "inner.city 不能为空" {
+		t.Errorf("expect inner.city 不能为空, got %v", m)
+	}
+}
@@ -0,0 +1,115 @@
+package fargo
+
+import (
+	"regexp"
+	"strings"
+)
+
+// acceptVersionRegexp 匹配 Accept header 中的版本, 如 application/vnd.app.v2+json.
+var acceptVersionRegexp = regexp.MustCompile(`(?i)application/vnd\.[^;,]*?\.?(v[0-9]+(?:\.[0-9]+)?)(?:\+[\w.-]+)?(?:$|[;,\s])`)
+
+// AddVersion 添加指定 API 版本的路由, 用法同 Add.
+// 版本路由等同于带有 /<version> 前缀的路由, 例如 AddVersion("v2", "/user/:id", &UserV2Controller{})
+// 可以通过 /v2/user/1 访问, 也可以通过 /user/1 加上 X-API-Version: 2 或者 Accept: application/vnd.app.v2+json 访问.
+// 请求的版本上没有匹配的路由时, 继续查找没有版本的路由.
+// Parameters:
+// - version:        API 版本, 如 v2, 也可以写作 2.
+// - pattern:        注册的路由 URI, 如 /index, /admin/id 等.
+// - c:              controller 的接口对象.
+// - mappingMethods: 不定项的路由参数, 用于自定义路由方法时候, 如 “post:postRouter;get:getIndex”.
+// Return:
+// - route:          添加的路由.
+func (p *ControllerRegistor) AddVersion(version, pattern string, c ControllerInterface, mappingMethods ...string) (route *Route) {
+	version = normalizeVersion(version)
+	p.versions[version] = true
+	return &Route{info: p.addRoute("", "", joinPattern("/"+version, pattern), c, mappingMethods...)}
+}
+
+// SetDefaultVersion 设置默认的 API 版本, 请求中没有指定版本时使用, 也可以通过配置 [web] apiversion 设置.
+// Parameters:
+// - version: API 版本, 如 v1, 为空时没有默认版本.
+func (p *ControllerRegistor) SetDefaultVersion(version string) {
+	if version != "" {
+		version = normalizeVersion(version)
+		p.versions[version] = true
+	}
+	p.defaultVersion = version
+}
+
+// DeprecateVersion 将 API 版本标记为废弃, 这些版本的请求会带上 Deprecation: true 的 response header,
+// 也可以通过配置 [web] deprecatedversions 设置, 多个版本用逗号分隔.
+// Parameters:
+// - versions: 废弃的 API 版本.
+func (p *ControllerRegistor) DeprecateVersion(versions ...string) {
+	for _, v := range versions {
+		if v = strings.TrimSpace(v); v != "" {
+			p.deprecatedVersions[normalizeVersion(v)] = true
+		}
+	}
+}
+
+// normalizeVersion 统一 API 版本的格式, "2", "V2" -> "v2".
+func normalizeVersion(version string) string {
+	version = strings.ToLower(strings.TrimSpace(version))
+	if !strings.HasPrefix(version, "v") {
+		version = "v" + version
+	}
+	return version
+}
+
+// requestVersion 获取请求的 API 版本, 依次从 url 前缀, X-API-Version header, Accept header 中获取,
+// 都没有时使用默认版本, url 前缀只识别注册过的版本.
+// Parameters:
+// - urlPath: 请求的 url path.
+// - header:  获取 request header 的函数.
+// Return:
+// - version: API 版本, 如 v2, 没有版本时为空.
+func (p *ControllerRegistor) requestVersion(urlPath string, header func(string) string) (version string) {
+	if len(p.versions) > 0 {
+		seg := strings.TrimPrefix(urlPath, "/")
+		if i := strings.Index(seg, "/"); i != -1 {
+			seg = seg[:i]
+		}
+		if seg = strings.ToLower(seg); p.versions[seg] {
+			return seg
+		}
+	}
+	if v := strings.TrimSpace(header("X-API-Version")); v != "" {
+		return normalizeVersion(v)
+	}
+	if m := acceptVersionRegexp.FindStringSubmatch(header("Accept")); m != nil {
+		return normalizeVersion(m[1])
+	}
+
+	return p.defaultVersion
+}
+
+// findVersionRouter 查找 API 版本对应的路由, 先查找版本路由, 没有找到时查找没有版本的路由.
+// Parameters:
+// - host:    请求的域名, 不含端口.
+// - version: 请求的 API 版本, 可以为空.
+// - method:  小写的 http 方法, 如 get, post 等.
+// - urlPath: 请求的 url path.
+// Return:
+// - route:   找到的路由, 没有找到为 nil.
+// - params:  url 以及域名中解析出的参数.
+func (p *ControllerRegistor) findVersionRouter(host, version, method, urlPath string) (route *controllerInfo, params map[string]string) {
+	if version == "" {
+		return p.findRouter(host, method, urlPath)
+	}
+
+	prefix := "/" + version
+	if urlPath != prefix && !strings.HasPrefix(strings.ToLower(urlPath), prefix+"/") {
+		// 版本来自 header 或者默认版本.
+		if route, params = p.findRouter(host, method, joinPattern(prefix, urlPath)); route != nil {
+			return
+		}
+		return p.findRouter(host, method, urlPath)
+	}
+
+	// 版本来自 url 前缀.
+	if route, params = p.findRouter(host, method, urlPath); route != nil {
+		return
+	}
+	return p.findRouter(host, method, joinPattern("", urlPath[len(prefix):]))
+}